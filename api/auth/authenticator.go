@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry its kind of credentials.
+var ErrNoCredentials = errors.New("Missing credentials")
+
+// Authenticator resolves the user of a request from one kind of
+// credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*TokenClaims, error)
+}
+
+// Authenticators tries each authenticator in turn. The first one to find
+// credentials decides, so invalid credentials are never silently skipped
+// in favour of others.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(r *http.Request) (*TokenClaims, error) {
+	for _, authenticator := range a {
+		claims, err := authenticator.Authenticate(r)
+		if err != ErrNoCredentials {
+			return claims, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// TokenTransport reads an access token from where a client sent it.
+type TokenTransport func(r *http.Request) string
+
+func (t TokenTransport) Authenticate(r *http.Request) (*TokenClaims, error) {
+	token := t(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	return ValidateToken(token)
+}
+
+// BearerToken reads the Authorization header.
+func BearerToken(r *http.Request) string {
+	bearerToken := r.Header.Get("Authorization")
+	if len(strings.Split(bearerToken, " ")) == 2 {
+		return strings.Split(bearerToken, " ")[1]
+	}
+	return ""
+}
+
+// CookieToken reads the cookie set by the login routes.
+func CookieToken(r *http.Request) string {
+	if !CookiesEnabled() {
+		return ""
+	}
+	if cookie, err := r.Cookie(TokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// QueryToken reads the token query parameter. Tokens in URLs end up in
+// logs, browser history and Referer headers, so it is only accepted with
+// AUTH_QUERY_TOKENS set to true, for old clients. Use signed URLs instead.
+func QueryToken(r *http.Request) string {
+	if os.Getenv("AUTH_QUERY_TOKENS") != "true" {
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Default authenticates the requests of the API.
+var Default Authenticator = Authenticators{
+	TokenTransport(BearerToken),
+	TokenTransport(CookieToken),
+	TokenTransport(QueryToken),
+	SignedURL{},
+}
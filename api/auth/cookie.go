@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	TokenCookie = "blogiris_token"
+	CSRFCookie  = "blogiris_csrf"
+	CSRFHeader  = "X-CSRF-Token"
+)
+
+// CookiesEnabled reports whether the login routes issue cookies, which
+// browsers authenticate with instead of bearer tokens. AUTH_COOKIE set to
+// false turns them off for deployments with bearer token clients only.
+func CookiesEnabled() bool {
+	return os.Getenv("AUTH_COOKIE") != "false"
+}
+
+// SecureCookies reports whether cookies are marked Secure, which they are
+// unless AUTH_COOKIE_SECURE is false, for local development over plain
+// HTTP.
+func SecureCookies() bool {
+	return os.Getenv("AUTH_COOKIE_SECURE") != "false"
+}
+
+// CSRFToken derives the CSRF token of an access token. Tying the two
+// together means a CSRF cookie planted by a sibling domain is useless
+// without the access token it belongs to.
+func CSRFToken(token string) string {
+	return Sign("csrf:" + token)
+}
+
+// SetAuthCookies stores the token in an HttpOnly cookie, next to a CSRF
+// cookie scripts can read. The CSRF token is also sent in the X-CSRF-Token
+// header, for pages on another origin that cannot read the API's cookies.
+func SetAuthCookies(w http.ResponseWriter, token string) {
+	csrf := CSRFToken(token)
+	http.SetCookie(w, authCookie(TokenCookie, token, int(TokenLifetime.Seconds()), true))
+	http.SetCookie(w, authCookie(CSRFCookie, csrf, int(TokenLifetime.Seconds()), false))
+	w.Header().Set(CSRFHeader, csrf)
+}
+
+// ClearAuthCookies logs the browser out.
+func ClearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, authCookie(TokenCookie, "", -1, true))
+	http.SetCookie(w, authCookie(CSRFCookie, "", -1, false))
+}
+
+// authCookie applies AUTH_COOKIE_DOMAIN and AUTH_COOKIE_SAMESITE, which is
+// lax unless set to strict or none, and SecureCookies.
+func authCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(os.Getenv("AUTH_COOKIE_SAMESITE")) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   os.Getenv("AUTH_COOKIE_DOMAIN"),
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   SecureCookies(),
+		SameSite: sameSite,
+	}
+}
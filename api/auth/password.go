@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMismatchedHashAndPassword = errors.New("hashedPassword is not the hash of the given password")
+	ErrUnknownPasswordHash       = errors.New("hashedPassword uses an unknown algorithm")
+)
+
+// PasswordHasher hashes passwords into self-describing encoded strings, so
+// that hashes made with other algorithms or parameters can still be verified.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Matches reports whether the hasher can verify the encoded hash.
+	Matches(encoded string) bool
+	Verify(encoded, password string) error
+	// NeedsRehash reports whether the hash was made with other parameters.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher encodes hashes in the PHC string format, for example
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func decodeArgon2id(encoded string) (*argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownPasswordHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrUnknownPasswordHash
+	}
+	p := &argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	return p, nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) error {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory || p.iterations != h.Iterations || p.parallelism != h.Parallelism ||
+		uint32(len(p.salt)) != h.SaltLength || uint32(len(p.key)) != h.KeyLength
+}
+
+// BcryptHasher handles bcrypt hashes, which are limited to 72 byte
+// passwords. It is kept to verify hashes created before Argon2id.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hashed), err
+}
+
+func (h *BcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrMismatchedHashAndPassword
+	}
+	return err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Hashers holds the default hasher first, followed by the ones that are only
+// used to verify existing hashes.
+var Hashers = []PasswordHasher{
+	NewArgon2idHasher(),
+	&BcryptHasher{Cost: bcrypt.DefaultCost},
+}
+
+// ConfigurePasswordHashers sets up the hashers from PASSWORD_HASHER
+// (argon2id or bcrypt), ARGON2_MEMORY, ARGON2_ITERATIONS,
+// ARGON2_PARALLELISM and BCRYPT_COST.
+func ConfigurePasswordHashers() error {
+	argon := NewArgon2idHasher()
+	bc := &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+	for name, target := range map[string]*uint32{
+		"ARGON2_MEMORY":     &argon.Memory,
+		"ARGON2_ITERATIONS": &argon.Iterations,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || n == 0 {
+				return fmt.Errorf("invalid %s: %q", name, v)
+			}
+			*target = uint32(n)
+		}
+	}
+	if v := os.Getenv("ARGON2_PARALLELISM"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid ARGON2_PARALLELISM: %q", v)
+		}
+		argon.Parallelism = uint8(n)
+	}
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < bcrypt.MinCost || n > bcrypt.MaxCost {
+			return fmt.Errorf("invalid BCRYPT_COST: %q", v)
+		}
+		bc.Cost = n
+	}
+
+	switch strings.ToLower(os.Getenv("PASSWORD_HASHER")) {
+	case "", "argon2id":
+		Hashers = []PasswordHasher{argon, bc}
+	case "bcrypt":
+		Hashers = []PasswordHasher{bc, argon}
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASHER: %q", os.Getenv("PASSWORD_HASHER"))
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	return Hashers[0].Hash(password)
+}
+
+func VerifyPassword(encoded, password string) error {
+	for _, h := range Hashers {
+		if h.Matches(encoded) {
+			return h.Verify(encoded, password)
+		}
+	}
+	return ErrUnknownPasswordHash
+}
+
+// PasswordNeedsRehash reports whether a hash should be replaced with one
+// made by the default hasher.
+func PasswordNeedsRehash(encoded string) bool {
+	return !Hashers[0].Matches(encoded) || Hashers[0].NeedsRehash(encoded)
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PasswordPolicy holds the rules new passwords and nicknames must follow.
+type PasswordPolicy struct {
+	MinLength       int
+	MaxLength       int
+	breached        map[string]struct{}
+	bannedNicknames map[string]struct{}
+}
+
+var Policy = &PasswordPolicy{MinLength: 8, MaxLength: 1024}
+
+// LoadPasswordPolicy configures the policy from PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_LENGTH, BANNED_NICKNAMES (comma separated) and
+// PASSWORD_BREACHED_FILE. The breached file holds one password per line,
+// either in plain text or as an uppercase SHA-1 hex digest with an optional
+// ":count" suffix as in the Have I Been Pwned downloads.
+func LoadPasswordPolicy() error {
+	p := &PasswordPolicy{MinLength: 8, MaxLength: 1024}
+
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %q", v)
+		}
+		p.MinLength = n
+	}
+	if v := os.Getenv("PASSWORD_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < p.MinLength {
+			return fmt.Errorf("invalid PASSWORD_MAX_LENGTH: %q", v)
+		}
+		p.MaxLength = n
+	}
+
+	for _, nickname := range strings.Split(os.Getenv("BANNED_NICKNAMES"), ",") {
+		nickname = strings.ToLower(strings.TrimSpace(nickname))
+		if nickname == "" {
+			continue
+		}
+		if p.bannedNicknames == nil {
+			p.bannedNicknames = map[string]struct{}{}
+		}
+		p.bannedNicknames[nickname] = struct{}{}
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		breached, err := loadBreachedPasswords(path)
+		if err != nil {
+			return err
+		}
+		p.breached = breached
+	}
+
+	Policy = p
+	return nil
+}
+
+func loadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if digest := strings.SplitN(line, ":", 2)[0]; isSHA1Hex(digest) {
+			breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	return breached, scanner.Err()
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func (p *PasswordPolicy) CheckPassword(password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("Password Must Be At Least %d Characters", p.MinLength)
+	}
+	if len(password) > p.MaxLength {
+		return fmt.Errorf("Password Must Be At Most %d Characters", p.MaxLength)
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return errors.New("Password Found In A Data Breach")
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) CheckNickname(nickname string) error {
+	if _, ok := p.bannedNicknames[strings.ToLower(nickname)]; ok {
+		return errors.New("Nickname Not Allowed")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Signed URLs let a user hand a link to a reader that cannot send
+// credentials, such as a feed reader. A link is signed for one path and
+// only authenticates GET requests to it, on routes that opt in with
+// AllowSignedURLs, until it expires or the session of the user that signed
+// it is revoked.
+
+const (
+	signedUserParam    = "uid"
+	signedSessionParam = "session"
+	signedExpiresParam = "expires"
+	signatureParam     = "signature"
+)
+
+var (
+	ErrSignedURLExpired = errors.New("Signed URL expired")
+	ErrSignedURLInvalid = errors.New("Invalid signed URL")
+)
+
+// SignedURLMaxTTL bounds how long links live, from SIGNED_URL_MAX_TTL. They
+// are revoked earlier with the session that signed them, such as when the
+// user logs out everywhere or is deleted.
+func SignedURLMaxTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SIGNED_URL_MAX_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+func signedURLPayload(path string, uid uint32, jti string, expires int64) string {
+	return fmt.Sprintf("signed-url:GET:%s:%d:%s:%d", path, uid, jti, expires)
+}
+
+// SignURL returns the query that authenticates GET requests to the path as
+// the user until the expiry, while the session with the jti is active.
+func SignURL(path string, uid uint32, jti string, expires time.Time) url.Values {
+	query := url.Values{}
+	query.Set(signedUserParam, strconv.FormatUint(uint64(uid), 10))
+	query.Set(signedSessionParam, jti)
+	query.Set(signedExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(signatureParam, Sign(signedURLPayload(path, uid, jti, expires.Unix())))
+	return query
+}
+
+type signedURLKey struct{}
+
+// AllowSignedURLs lets signed URLs authenticate requests to a route.
+func AllowSignedURLs(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), signedURLKey{}, true)))
+	}
+}
+
+// SignedURL authenticates the GET requests of signed URLs.
+type SignedURL struct{}
+
+func (SignedURL) Authenticate(r *http.Request) (*TokenClaims, error) {
+	query := r.URL.Query()
+	signature := query.Get(signatureParam)
+	if signature == "" {
+		return nil, ErrNoCredentials
+	}
+	allowed, _ := r.Context().Value(signedURLKey{}).(bool)
+	if !allowed || (r.Method != "GET" && r.Method != "HEAD") {
+		return nil, ErrSignedURLInvalid
+	}
+	uid, err := strconv.ParseUint(query.Get(signedUserParam), 10, 32)
+	if err != nil {
+		return nil, ErrSignedURLInvalid
+	}
+	expires, err := strconv.ParseInt(query.Get(signedExpiresParam), 10, 64)
+	if err != nil {
+		return nil, ErrSignedURLInvalid
+	}
+	jti := query.Get(signedSessionParam)
+	if !VerifySignature(signedURLPayload(r.URL.Path, uint32(uid), jti, expires), signature) {
+		return nil, ErrSignedURLInvalid
+	}
+	if time.Now().Unix() > expires {
+		return nil, ErrSignedURLExpired
+	}
+	if Sessions != nil {
+		err = Sessions.ValidateSession(jti, uint32(uid))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &TokenClaims{UserID: uint32(uid), SignedURL: true}, nil
+}
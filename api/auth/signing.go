@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+)
+
+// Sign returns an HMAC-SHA256 signature of value keyed with API_SECRET.
+func Sign(value string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("API_SECRET")))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(value, signature string) bool {
+	return hmac.Equal([]byte(Sign(value)), []byte(signature))
+}
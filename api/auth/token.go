@@ -1,29 +1,47 @@
 package auth
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 )
 
-func CreateToken(user_id uint32) (string, error) {
+const TokenLifetime = time.Hour * 1
+
+// SessionStore reports whether the session a token was issued for is still
+// active.
+type SessionStore interface {
+	ValidateSession(jti string, userID uint32) error
+}
+
+// Sessions is consulted for every token when set, so that revoked sessions
+// stop authenticating before their tokens expire.
+var Sessions SessionStore
+
+type TokenClaims struct {
+	UserID uint32
+	ID     string
+	// SignedURL is set when the request was authenticated by a signed URL
+	// rather than a session, which has no ID.
+	SignedURL bool
+}
+
+func CreateToken(user_id uint32, jti string) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() // Token expires after 1 hour
+	claims["jti"] = jti
+	claims["exp"] = time.Now().Add(TokenLifetime).Unix() // Token expires after 1 hour
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("API_SECRET")))
 }
 
-func TokenValid(r *http.Request) error {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(
 		tokenString,
 		func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -31,59 +49,78 @@ func TokenValid(r *http.Request) error {
 			}
 			return []byte(os.Getenv("API_SECRET")), nil
 		})
-	if err != nil {
-		return err
-	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
-	}
-	return nil
 }
 
+func TokenValid(r *http.Request) error {
+	_, err := ExtractTokenClaims(r)
+	return err
+}
+
+// ExtractToken returns the access token the request was sent with, if any.
 func ExtractToken(r *http.Request) string {
-	keys := r.URL.Query()
-	token := keys.Get("token")
-	if token != "" {
-		return token
-	}
-	bearerToken := r.Header.Get("Authorization")
-	if len(strings.Split(bearerToken, " ")) == 2 {
-		return strings.Split(bearerToken, " ")[1]
+	for _, transport := range []TokenTransport{BearerToken, CookieToken, QueryToken} {
+		if token := transport(r); token != "" {
+			return token
+		}
 	}
 	return ""
 }
 
-func ExtractTokenID(r *http.Request) (uint32, error) {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(
-		tokenString,
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("API_SECRET")), nil
-		})
+// ExtractTokenClaims authenticates the request with the Default
+// authenticator and returns its claims.
+func ExtractTokenClaims(r *http.Request) (*TokenClaims, error) {
+	return Default.Authenticate(r)
+}
+
+// ValidateToken checks an access token, including its session when a
+// session store is configured, and returns its claims.
+func ValidateToken(tokenString string) (*TokenClaims, error) {
+	tc, err := parseClaims(tokenString)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
+	if Sessions != nil {
+		err = Sessions.ValidateSession(tc.ID, tc.UserID)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		return uint32(uid), nil
 	}
-	return 0, nil
+	return tc, nil
+}
+
+// TokenSubject returns the user an access token was issued to, checking
+// only its signature and expiry. Its session may have been revoked, so it
+// tells clients apart without authenticating them.
+func TokenSubject(tokenString string) (uint32, error) {
+	tc, err := parseClaims(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return tc.UserID, nil
 }
 
-//Pretty display the claims licely in the terminal
-func Pretty(data interface{}) {
-	b, err := json.MarshalIndent(data, "", " ")
+func parseClaims(tokenString string) (*TokenClaims, error) {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+	uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, err
 	}
+	tc := &TokenClaims{UserID: uint32(uid)}
+	tc.ID, _ = claims["jti"].(string)
+	return tc, nil
+}
 
-	fmt.Println(string(b))
+func ExtractTokenID(r *http.Request) (uint32, error) {
+	claims, err := ExtractTokenClaims(r)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
 }
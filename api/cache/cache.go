@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores rendered responses shared by all requests. Errors are
+// reported, but callers treat them as misses rather than failing requests.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// TTL is how long responses stay cached, from CACHE_TTL.
+func TTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Minute
+}
+
+// FromEnv returns the cache chosen by CACHE_BACKEND: "memory" (the
+// default) keeps up to CACHE_SIZE entries in process, "redis" uses the
+// server at REDIS_URL and "none" disables caching.
+func FromEnv() (Cache, error) {
+	switch backend := strings.ToLower(os.Getenv("CACHE_BACKEND")); backend {
+	case "", "memory":
+		size, err := strconv.Atoi(os.Getenv("CACHE_SIZE"))
+		if err != nil || size < 1 {
+			size = 1000
+		}
+		return NewLRU(size), nil
+	case "redis":
+		opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return NewRedis(redis.NewClient(opts)), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q", backend)
+	}
+}
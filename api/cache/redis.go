@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps the cache in a Redis compatible server, so that every
+// instance of the API shares it.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{Client: client, Prefix: "blogiris:"}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.Client.Get(ctx, c.Prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores the value, forever when ttl is zero.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.Client.Set(ctx, c.Prefix+key, value, ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.Prefix + key
+	}
+	return c.Client.Del(ctx, prefixed...).Err()
+}
+
+// Ping lets readiness check the Redis server.
+func (c *Redis) Ping(ctx context.Context) error {
+	return c.Client.Ping(ctx).Err()
+}
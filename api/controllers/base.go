@@ -1,21 +1,57 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"    //mysql database driver
 	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres database driver
 
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/cache"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/mailer"
+	"github.com/Funskie/blogIris/api/metrics"
+	"github.com/Funskie/blogIris/api/middlewares"
 	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/notify"
+	"github.com/Funskie/blogIris/api/ratelimit"
+	"github.com/Funskie/blogIris/api/tracing"
 )
 
 type Server struct {
-	DB     *gorm.DB
-	Router *mux.Router
+	DB            *gorm.DB
+	Router        *mux.Router
+	OIDCProviders map[string]*auth.OIDCProvider
+	Mailer        mailer.Mailer
+	Cache         cache.Cache
+	RateLimiter   *middlewares.RateLimiter
+	CORS          *middlewares.CORS
+	Notifier      notify.Broker
+
+	shuttingDown atomic.Bool
+	// stopping is closed when shutdown begins, which ends the streams
+	// that would otherwise hold it up.
+	stopping chan struct{}
+	// tasks tracks the work requests left running after answering, which
+	// shutdown waits for.
+	tasks sync.WaitGroup
+}
+
+// migratedModels are migrated on start and checked for by readiness.
+var migratedModels = []interface{}{
+	&models.User{}, &models.Post{}, &models.Identity{}, &models.OneTimeToken{}, &models.Session{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{},
 }
 
 func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbPort, DbHost, DbName string) {
@@ -25,31 +61,179 @@ func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbPort, DbHost, D
 		DBURL := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local", DbUser, DbPassword, DbHost, DbPort, DbName)
 		server.DB, err = gorm.Open(Dbdriver, DBURL)
 		if err != nil {
-			fmt.Printf("Cannot connect to %s database", Dbdriver)
+			slog.Error("Cannot connect to database", "driver", Dbdriver)
 			log.Fatal("This is the error:", err)
 		} else {
-			fmt.Printf("We are connected to the %s database", Dbdriver)
+			slog.Info("We are connected to the database", "driver", Dbdriver)
 		}
 	}
 	if Dbdriver == "postgres" {
-		DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=&s sslmode=disable password=%s", DbHost, DbPort, DbUser, DbName, DbPassword)
+		DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", DbHost, DbPort, DbUser, DbName, DbPassword)
 		server.DB, err = gorm.Open(Dbdriver, DBURL)
 		if err != nil {
-			fmt.Printf("Cannot connect to %s database", Dbdriver)
+			slog.Error("Cannot connect to database", "driver", Dbdriver)
 			log.Fatal("This is the error:", err)
 		} else {
-			fmt.Printf("We are connected to the %s database", Dbdriver)
+			slog.Info("We are connected to the database", "driver", Dbdriver)
 		}
 	}
 
-	server.DB.Debug().AutoMigrate(&models.User{}, &models.Post{})
+	// Queries always reach the logger, which keeps the slow ones and,
+	// with LOG_SQL, all of them.
+	server.DB.LogMode(true)
+	server.DB.SetLogger(logger.NewGormLogger(slog.Default(), logger.ConfigFromEnv()))
+	metrics.RegisterGormCallbacks(server.DB)
+	tracing.RegisterGormCallbacks(server.DB)
+	metrics.RegisterDB(server.DB.DB(), DbName)
+
+	server.DB.AutoMigrate(migratedModels...)
+	auth.Sessions = models.SessionStore{DB: server.DB}
+
+	err = auth.ConfigurePasswordHashers()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+	err = auth.LoadPasswordPolicy()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+	err = models.LoadReactionKinds()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+	err = models.LoadProfileURL()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+
+	server.OIDCProviders, err = auth.LoadOIDCProviders()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
 
-	server.Router = mux.NewRouter()
+	server.Mailer = mailer.FromEnv()
 
-	server.initializeRoutes()
+	server.Cache, err = cache.FromEnv()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+
+	rateLimits, err := ratelimit.FromEnv()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+	server.RateLimiter, err = middlewares.NewRateLimiter(rateLimits)
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+
+	server.CORS, err = middlewares.NewCORS()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+
+	server.Notifier, err = notify.FromEnv()
+	if err != nil {
+		log.Fatal("This is the error:", err)
+	}
+
+	server.SetupRouter()
 }
 
+// db returns the database handle for the request, which traces its queries
+// under the request's span. A nil request gets the plain handle.
+func (server *Server) db(r *http.Request) *gorm.DB {
+	if r == nil {
+		return server.DB
+	}
+	return tracing.WithContext(server.DB, r.Context())
+}
+
+// background runs task after the request is answered, with the request's
+// logger and trace but not its cancellation.
+func (server *Server) background(r *http.Request, task func(ctx context.Context)) {
+	ctx := context.WithoutCancel(r.Context())
+	server.tasks.Add(1)
+	go func() {
+		defer server.tasks.Done()
+		task(ctx)
+	}()
+}
+
+// Run serves until SIGINT or SIGTERM, then stops accepting connections,
+// waits up to SHUTDOWN_TIMEOUT for in-flight requests and the tasks they
+// left running, and closes the database. Timeouts come from
+// HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT.
 func (server *Server) Run(addr string) {
-	fmt.Println("Listening to port 8080")
-	log.Fatal(http.ListenAndServe(addr, server.Router))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           server.Router,
+		ReadTimeout:       durationFromEnv("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      durationFromEnv("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       durationFromEnv("HTTP_IDLE_TIMEOUT", 60*time.Second),
+	}
+	servers := []*http.Server{srv}
+	server.stopping = make(chan struct{})
+
+	// Metrics can be kept off the public listener by serving them on an
+	// internal address instead.
+	if metricsAddr := os.Getenv("METRICS_ADDR"); metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		servers = append(servers, &http.Server{
+			Addr:              metricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 5 * time.Second,
+		})
+	}
+
+	for _, s := range servers {
+		go func(s *http.Server) {
+			slog.Info("Listening", "addr", s.Addr)
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}(s)
+	}
+
+	go server.purgeTrash(ctx)
+
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down")
+	server.shuttingDown.Store(true)
+	close(server.stopping)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), durationFromEnv("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Cannot drain connections", "addr", s.Addr, "error", err)
+		}
+	}
+	tasksDone := make(chan struct{})
+	go func() {
+		server.tasks.Wait()
+		close(tasksDone)
+	}()
+	select {
+	case <-tasksDone:
+	case <-shutdownCtx.Done():
+		slog.Error("Cannot finish background tasks", "error", shutdownCtx.Err())
+	}
+	if err := server.DB.Close(); err != nil {
+		slog.Error("Cannot close database", "error", err)
+	}
+	slog.Info("Stopped")
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
 }
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// GetBookmarks lists the posts the caller bookmarked, latest first.
+func (server *Server) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	bookmark := models.Bookmark{}
+	posts, err := bookmark.FindBookmarkedPosts(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, posts)
+}
+
+// AddBookmark bookmarks the post for the caller. Bookmarking it again
+// changes nothing and answers 200 instead of 201.
+func (server *Server) AddBookmark(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	post := models.Post{}
+	_, err = post.FindPostByID(server.db(r), pid)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bookmark := models.Bookmark{UserID: uid, PostID: pid}
+	created, err := bookmark.SaveBookmark(server.db(r))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	responses.JSON(w, status, bookmark)
+}
+
+// DeleteBookmark removes the caller's bookmark of the post, which may be in
+// the trash.
+func (server *Server) DeleteBookmark(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	bookmark := models.Bookmark{}
+	deleted, err := bookmark.DeleteBookmark(server.db(r), uid, pid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deleted == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("Bookmark not found"))
+		return
+	}
+	responses.NoContent(w)
+}
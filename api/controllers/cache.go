@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/cache"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// Post responses are cached under a version that every post or user
+// mutation replaces, which drops them all at once without listing keys.
+// Reactions only drop the response of their post, lists show the new counts
+// once their entries expire.
+const postsVersionKey = "posts:version"
+
+// cachedResponse is a rendered response body with its validators. Private
+// responses hold state of the reader that the validators leave out.
+type cachedResponse struct {
+	Body         []byte    `json:"body"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	private      bool
+}
+
+// newPostsResponse renders v, the JSON form of the posts, with their
+// validators.
+func newPostsResponse(key string, v interface{}, posts ...models.Post) (*cachedResponse, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	resp := &cachedResponse{Body: append(body, '\n')}
+	resp.ETag, resp.LastModified = postValidators(key, posts...)
+	return resp, nil
+}
+
+// postValidators derives a strong ETag from the key, the versions and
+// modification times of the posts and their authors, the rendered
+// content, which links mentions of users only while they are not in the
+// trash, and the reaction counts, so any edit that changes the shared body
+// changes the tag. The bookmark flags of the reader are left out, the tag
+// is the same for everyone and can be sent back in If-Match.
+func postValidators(key string, posts ...models.Post) (string, time.Time) {
+	var lastModified time.Time
+	h := sha256.New()
+	fmt.Fprintln(h, key)
+	for _, p := range posts {
+		fmt.Fprintln(h, p.ID, p.Version, p.UpdatedAt.UnixNano(), p.Author.UpdatedAt.UnixNano(), p.ContentHTML, p.Reactions)
+		times := []time.Time{p.UpdatedAt, p.Author.UpdatedAt}
+		if p.ReactedAt != nil {
+			times = append(times, *p.ReactedAt)
+		}
+		for _, t := range times {
+			if t.After(lastModified) {
+				lastModified = t
+			}
+		}
+	}
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]) + `"`, lastModified
+}
+
+// cachedPosts returns the response cached under key, or renders it with
+// load and caches it. Cache failures are logged and treated as misses.
+func (server *Server) cachedPosts(r *http.Request, key string, load func() (*cachedResponse, error)) (*cachedResponse, error) {
+	if server.Cache == nil {
+		return load()
+	}
+	ctx := r.Context()
+	log := logger.FromContext(ctx)
+
+	version, found, err := server.Cache.Get(ctx, postsVersionKey)
+	if err != nil {
+		log.Warn("cache unavailable", "error", err)
+		return load()
+	}
+	if !found {
+		version, err = server.newPostsVersion(r)
+		if err != nil {
+			log.Warn("cache unavailable", "error", err)
+			return load()
+		}
+	}
+	key = "posts:" + string(version) + ":" + key
+
+	data, found, err := server.Cache.Get(ctx, key)
+	if err != nil {
+		log.Warn("cache unavailable", "error", err)
+	}
+	if found {
+		resp := &cachedResponse{}
+		if json.Unmarshal(data, resp) == nil {
+			return resp, nil
+		}
+	}
+
+	resp, err := load()
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(resp)
+	if err == nil {
+		err = server.Cache.Set(ctx, key, data, cache.TTL())
+	}
+	if err != nil {
+		log.Warn("cannot cache response", "error", err)
+	}
+	return resp, nil
+}
+
+// reader returns the signed in user reading public posts, if any. Bad
+// credentials are ignored, the posts are public anyway.
+func (server *Server) reader(r *http.Request) (uint32, bool) {
+	uid, err := auth.ExtractTokenID(r)
+	return uid, err == nil
+}
+
+// readerPosts returns the posts response under key. Anonymous readers share
+// the cached response, signed in readers get a private one rendered by load
+// with their bookmarks marked. Bookmarks are not part of the validators, so
+// the private response is never answered with 304 Not Modified.
+func (server *Server) readerPosts(w http.ResponseWriter, r *http.Request, signedIn bool, key string, load func() (*cachedResponse, error)) (*cachedResponse, error) {
+	w.Header().Add("Vary", "Authorization, Cookie")
+	if !signedIn {
+		return server.cachedPosts(r, key, load)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	resp, err := load()
+	if err != nil {
+		return nil, err
+	}
+	resp.LastModified = time.Time{}
+	resp.private = true
+	return resp, nil
+}
+
+func (server *Server) newPostsVersion(r *http.Request) ([]byte, error) {
+	random, err := auth.RandomString(6)
+	if err != nil {
+		return nil, err
+	}
+	version := []byte(strconv.FormatInt(time.Now().UnixNano(), 36) + "." + random)
+	return version, server.Cache.Set(r.Context(), postsVersionKey, version, 0)
+}
+
+// postsChangedAt is when the cached post responses were last invalidated,
+// zero without a cache. Lists are last modified then rather than when
+// their posts were, which deleting a post does not move forward.
+func (server *Server) postsChangedAt(r *http.Request) time.Time {
+	if server.Cache == nil {
+		return time.Time{}
+	}
+	version, found, err := server.Cache.Get(r.Context(), postsVersionKey)
+	if err != nil || !found {
+		return time.Time{}
+	}
+	nanos, _, _ := strings.Cut(string(version), ".")
+	n, err := strconv.ParseInt(nanos, 36, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// invalidatePosts drops every cached post response. It is called after
+// mutations of posts and of users, who are embedded in posts as authors.
+func (server *Server) invalidatePosts(r *http.Request) {
+	if server.Cache == nil {
+		return
+	}
+	_, err := server.newPostsVersion(r)
+	if err != nil {
+		// Without a new version stale entries would be served until they
+		// expire, so at least try to remove the current one.
+		logger.FromContext(r.Context()).Error("cannot invalidate cached posts", "error", err)
+		server.Cache.Delete(r.Context(), postsVersionKey)
+	}
+}
+
+// invalidatePost drops the cached response of the post alone, leaving the
+// lists and the other posts cached under the current version.
+func (server *Server) invalidatePost(r *http.Request, pid uint64) {
+	if server.Cache == nil {
+		return
+	}
+	ctx := r.Context()
+	version, found, err := server.Cache.Get(ctx, postsVersionKey)
+	if err == nil && found {
+		err = server.Cache.Delete(ctx, "posts:"+string(version)+":"+postKey(pid))
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("cannot invalidate cached post", "post_id", pid, "error", err)
+	}
+}
+
+// postKey is the cache key of the response of a single post.
+func postKey(pid uint64) string {
+	return "post:" + strconv.FormatUint(pid, 10)
+}
+
+// writeCached writes the response, or 304 Not Modified when the client's
+// copy of a shared response is current.
+func writeCached(w http.ResponseWriter, r *http.Request, resp *cachedResponse) {
+	if !resp.private && responses.NotModified(w, r, resp.ETag, resp.LastModified) {
+		return
+	}
+	responses.SetValidators(w, resp.ETag, resp.LastModified)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.Body)
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// followList is a page of followers or followed users with the counts of
+// both lists.
+type followList struct {
+	models.FollowCounts
+	Users []models.User `json:"users"`
+}
+
+// followedUser parses the user ID of the URL and looks the user up,
+// writing the error response when it is invalid or the user is unknown
+// or in the trash.
+func (server *Server) followedUser(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	user := models.User{}
+	_, err = user.FindUserByID(server.db(r), uint32(uid))
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return 0, false
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	return uint32(uid), true
+}
+
+// FollowUser makes the caller follow the user. Following again changes
+// nothing and answers 200 instead of 201.
+func (server *Server) FollowUser(w http.ResponseWriter, r *http.Request) {
+
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	uid, ok := server.followedUser(w, r)
+	if !ok {
+		return
+	}
+
+	follow := models.Follow{FollowerID: tokenID, FollowedID: uid}
+	created, err := follow.SaveFollow(server.db(r))
+	if err == models.ErrFollowSelf {
+		responses.Error(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	counts, err := models.CountFollows(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		server.notify(r, &models.Notification{UserID: uid, Type: models.NotificationFollow, ActorID: tokenID})
+	}
+	responses.JSON(w, status, counts)
+}
+
+// UnfollowUser stops the caller following the user.
+func (server *Server) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Users in the trash can still be unfollowed.
+	follow := models.Follow{}
+	deleted, err := follow.DeleteFollow(server.db(r), tokenID, uint32(uid))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deleted == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("Not following this user"))
+		return
+	}
+	responses.NoContent(w)
+}
+
+func (server *Server) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	server.writeFollowList(w, r, (*models.Follow).FindFollowers)
+}
+
+func (server *Server) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	server.writeFollowList(w, r, (*models.Follow).FindFollowing)
+}
+
+func (server *Server) writeFollowList(w http.ResponseWriter, r *http.Request, find func(*models.Follow, *gorm.DB, uint32) (*[]models.User, error)) {
+	uid, ok := server.followedUser(w, r)
+	if !ok {
+		return
+	}
+
+	counts, err := models.CountFollows(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	users, err := find(&models.Follow{}, server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, followList{FollowCounts: counts, Users: *users})
+}
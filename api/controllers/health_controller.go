@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// pinger is implemented by dependencies that can check their connection.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Healthz reports that the process is up. It deliberately checks nothing
+// else, so that a database outage does not get the process restarted.
+func (server *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether the server should receive traffic: the database is
+// reachable and migrated and the services it depends on answer. It fails as
+// soon as shutdown begins so that traffic drains away first.
+func (server *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]error{}
+	if server.shuttingDown.Load() {
+		checks["server"] = errors.New("shutting down")
+	}
+	checks["database"] = server.DB.DB().PingContext(ctx)
+	if checks["database"] == nil {
+		checks["migrations"] = server.pendingMigrations()
+	}
+	if p, ok := server.Mailer.(pinger); ok {
+		checks["smtp"] = p.Ping(ctx)
+	}
+	if p, ok := server.Cache.(pinger); ok {
+		checks["cache"] = p.Ping(ctx)
+	}
+	if p, ok := server.Notifier.(pinger); ok {
+		checks["notify"] = p.Ping(ctx)
+	}
+	if server.RateLimiter != nil {
+		if p, ok := server.RateLimiter.Store.(pinger); ok {
+			checks["rate_limit"] = p.Ping(ctx)
+		}
+	}
+	for name, provider := range server.OIDCProviders {
+		checks["oidc:"+name] = provider.Discover(ctx)
+	}
+
+	status := http.StatusOK
+	result := readiness{Status: "ready", Checks: map[string]string{}}
+	for name, err := range checks {
+		result.Checks[name] = "ok"
+		if err != nil {
+			result.Checks[name] = err.Error()
+			result.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	responses.JSON(w, status, result)
+}
+
+// pendingMigrations reports the tables of the models that are missing.
+func (server *Server) pendingMigrations() error {
+	var missing []string
+	for _, model := range migratedModels {
+		table := server.DB.NewScope(model).TableName()
+		if !server.DB.HasTable(table) {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables %v", missing)
+	}
+	return nil
+}
@@ -4,56 +4,79 @@ import (
 	"github.com/Funskie/blogIris/api/auth"
 	"github.com/Funskie/blogIris/api/models"
 	"github.com/Funskie/blogIris/api/responses"
+	"github.com/Funskie/blogIris/api/tracing"
 	"github.com/Funskie/blogIris/api/utils/formaterror"
 
-	"encoding/json"
-	"golang.org/x/crypto/bcrypt"
-	"io/ioutil"
 	"net/http"
 )
 
+type loginInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
 func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+	input := loginInput{}
+	if !bind(w, r, &input) {
 		return
 	}
 
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	user := models.User{Email: input.Email, Password: input.Password}
+	user.Prepare()
+	err := user.Validate("login")
 	if err != nil {
 		responses.Error(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	user.Prepare()
-	err = user.Validate("login")
+	userFound, err := server.authenticate(r, user.Email, user.Password)
 	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+		formattedError := formaterror.FormatError(err.Error())
+		responses.Error(w, http.StatusUnprocessableEntity, formattedError)
 		return
 	}
 
-	token, err := server.SignIn(user.Email, user.Password)
+	token, err := server.issueToken(r, userFound.ID)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.Error(w, http.StatusUnprocessableEntity, formattedError)
+		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
+	if auth.CookiesEnabled() {
+		auth.SetAuthCookies(w, token)
+	}
 	responses.JSON(w, http.StatusOK, token)
 }
 
 func (server *Server) SignIn(email, password string) (string, error) {
 
-	user := models.User{}
-	err := server.DB.Debug().Where("email = ?", email).First(&user).Error
+	user, err := server.authenticate(nil, email, password)
 	if err != nil {
 		return "", err
 	}
+	return server.issueToken(nil, user.ID)
+}
 
-	err = models.VerifyPassword(user.Password, password)
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return "", err
+func (server *Server) authenticate(r *http.Request, email, password string) (*models.User, error) {
+
+	user := models.User{}
+	_, err := user.FindUserByEmail(server.db(r), email)
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	err = models.VerifyPasswordContext(tracing.Context(server.db(r)), user.Password, password)
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	// Hashes made with an older algorithm or weaker parameters are upgraded
+	// while the plain text password is at hand.
+	if auth.PasswordNeedsRehash(user.Password) {
+		err = user.UpdatePassword(server.db(r), password)
+		if err != nil {
+			return &models.User{}, err
+		}
 	}
-	return auth.CreateToken(user.ID)
+	return &user, nil
 }
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+	"github.com/Funskie/blogIris/api/tracing"
+)
+
+const (
+	magicLinkPurpose = "magic_link"
+	magicLinkCookie  = "magic_link_device"
+)
+
+type magicLinkData struct {
+	DeviceHash string `json:"device_hash"`
+}
+
+func magicLinkTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("MAGIC_LINK_TTL"))
+	if err != nil || ttl <= 0 {
+		return 15 * time.Minute
+	}
+	return ttl
+}
+
+func magicLinkMaxPerHour() int {
+	max, err := strconv.Atoi(os.Getenv("MAGIC_LINK_MAX_PER_HOUR"))
+	if err != nil || max <= 0 {
+		return 5
+	}
+	return max
+}
+
+func magicLinkPayload(token string, exp int64) string {
+	return fmt.Sprintf("%s:%s:%d", magicLinkPurpose, token, exp)
+}
+
+type magicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// RequestMagicLink mails a login link to the email, if it has an account.
+// Every request gets the same answer, with the device cookie, and counts
+// towards the limit of the email, so the endpoint does not reveal which
+// addresses have an account. The mail is sent in the background and its
+// failures are only logged for the same reason.
+func (server *Server) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+
+	input := magicLinkRequest{}
+	if !bind(w, r, &input) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+
+	issued, err := models.CountOneTimeTokens(server.db(r), magicLinkPurpose, email, time.Now().Add(-time.Hour))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if issued >= magicLinkMaxPerHour() {
+		w.Header().Set("Retry-After", "3600")
+		responses.Error(w, http.StatusTooManyRequests, errors.New("Too Many Requests"))
+		return
+	}
+
+	// The link only works in the browser that requested it, which is
+	// identified by a random secret kept in a cookie.
+	device, err := auth.RandomString(32)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	data, err := json.Marshal(magicLinkData{DeviceHash: models.HashToken(device)})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// A token is issued for unknown emails too, it records the attempt and
+	// cannot log anyone in.
+	ttl := magicLinkTTL()
+	token, stored, err := models.IssueOneTimeToken(server.db(r), magicLinkPurpose, email, string(data), ttl)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	exp := stored.ExpiresAt.Unix()
+	query := url.Values{}
+	query.Set("token", token)
+	query.Set("exp", strconv.FormatInt(exp, 10))
+	query.Set("sig", auth.Sign(magicLinkPayload(token, exp)))
+	link := fmt.Sprintf("%s/login/magic/verify?%s", strings.TrimSuffix(os.Getenv("APP_URL"), "/"), query.Encode())
+	body := fmt.Sprintf("Use this link to log in. It expires in %s and works once.\n\n%s\n", ttl, link)
+
+	// The account is looked up and mailed after answering, so that both
+	// take the same time whether the email is registered or not.
+	server.background(r, func(ctx context.Context) {
+		user := models.User{}
+		_, err := user.FindUserByEmail(tracing.WithContext(server.DB, ctx), email)
+		if err != nil {
+			if !gorm.IsRecordNotFoundError(err) {
+				logger.FromContext(ctx).Error("cannot look up login link email", "error", err)
+			}
+			return
+		}
+		_, span := tracing.Start(ctx, "mail.send", attribute.String("mail.subject", "Your login link"))
+		err = server.Mailer.Send(user.Email, "Your login link", body)
+		tracing.End(span, err)
+		if err != nil {
+			logger.FromContext(ctx).Error("cannot send login link", "error", err)
+		}
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    device,
+		Path:     "/login/magic",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   auth.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	responses.JSON(w, http.StatusAccepted, "If the email is registered, a login link has been sent")
+}
+
+func (server *Server) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	token := query.Get("token")
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if token == "" || err != nil || !auth.VerifySignature(magicLinkPayload(token, exp), query.Get("sig")) {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid Link"))
+		return
+	}
+	if time.Now().Unix() > exp {
+		responses.Error(w, http.StatusGone, errors.New("Link Expired"))
+		return
+	}
+
+	stored, err := models.ConsumeOneTimeToken(server.db(r), magicLinkPurpose, token)
+	switch err {
+	case nil:
+	case models.ErrTokenConsumed:
+		responses.Error(w, http.StatusGone, errors.New("Link Already Used"))
+		return
+	case models.ErrTokenExpired:
+		responses.Error(w, http.StatusGone, errors.New("Link Expired"))
+		return
+	case models.ErrTokenNotFound:
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid Link"))
+		return
+	default:
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := magicLinkData{}
+	err = json.Unmarshal([]byte(stored.Data), &data)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	cookie, err := r.Cookie(magicLinkCookie)
+	if err != nil || models.HashToken(cookie.Value) != data.DeviceHash {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Link Opened On Another Device"))
+		return
+	}
+
+	user := models.User{}
+	_, err = user.FindUserByEmail(server.db(r), stored.Subject)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid Link"))
+		return
+	}
+
+	jwt, err := server.issueToken(r, user.ID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if auth.CookiesEnabled() {
+		auth.SetAuthCookies(w, jwt)
+	}
+	http.SetCookie(w, &http.Cookie{Name: magicLinkCookie, Path: "/login/magic", MaxAge: -1})
+	responses.JSON(w, http.StatusOK, jwt)
+}
@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/notify"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const (
+	notificationPageSize    = 20
+	notificationMaxPageSize = 100
+
+	// streamWriteTimeout bounds each write to a stream, which outlives the
+	// server's write timeout.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// The events of notification streams: a new notification, and the count
+// of unread ones when it changes otherwise.
+const (
+	eventNotification = "notification"
+	eventUnread       = "unread"
+)
+
+// notificationPage is a page of the caller's inbox. NextCursor is missing
+// on the last page.
+type notificationPage struct {
+	Notifications []models.Notification `json:"notifications"`
+	UnreadCount   int                   `json:"unread_count"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+}
+
+type unreadCount struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+// notificationPreferences turns types of notification on or off.
+type notificationPreferences map[string]bool
+
+// GetNotifications lists the caller's notifications, newest first, only
+// the unread ones with ?unread=true. The next page is requested with the
+// cursor of the previous one, also given in a Link header.
+func (server *Server) GetNotifications(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	query := r.URL.Query()
+	limit := notificationPageSize
+	if param := query.Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > notificationMaxPageSize {
+			responses.Error(w, http.StatusBadRequest, errors.New("Limit Must Be Between 1 And 100"))
+			return
+		}
+	}
+	unreadOnly := false
+	if param := query.Get("unread"); param != "" {
+		unreadOnly, err = strconv.ParseBool(param)
+		if err != nil {
+			responses.Error(w, http.StatusBadRequest, errors.New("Unread Must Be true Or false"))
+			return
+		}
+	}
+	var before uint64
+	if param := query.Get("cursor"); param != "" {
+		before, err = strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			responses.Error(w, http.StatusBadRequest, models.ErrInvalidCursor)
+			return
+		}
+	}
+
+	notifications, err := models.FindNotifications(server.db(r), uid, unreadOnly, before, limit)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	unread, err := models.CountUnreadNotifications(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := notificationPage{Notifications: *notifications, UnreadCount: unread}
+	if len(page.Notifications) > limit {
+		page.Notifications = page.Notifications[:limit]
+		page.NextCursor = strconv.FormatUint(page.Notifications[limit-1].ID, 10)
+		query.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", `<`+baseURL(r)+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+	}
+	responses.JSON(w, http.StatusOK, page)
+}
+
+// ReadNotification marks one of the caller's notifications as read and
+// answers the count of those left unread.
+func (server *Server) ReadNotification(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	notification := models.Notification{}
+	_, err = notification.MarkRead(server.db(r), uid, id)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("Notification not found"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.writeUnreadCount(w, r, uid)
+}
+
+// ReadAllNotifications marks the caller's notifications as read, only
+// those up to the ?until= ID when given, and answers the count of those
+// left unread.
+func (server *Server) ReadAllNotifications(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	var until uint64
+	if param := r.URL.Query().Get("until"); param != "" {
+		until, err = strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			responses.Error(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	_, err = models.MarkAllNotificationsRead(server.db(r), uid, until)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.writeUnreadCount(w, r, uid)
+}
+
+// writeUnreadCount writes the count of the user's unread notifications,
+// and pushes it to their streams so that their other clients update too.
+func (server *Server) writeUnreadCount(w http.ResponseWriter, r *http.Request, uid uint32) {
+	unread, err := models.CountUnreadNotifications(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.publish(r, uid, unreadEvent(unread))
+	responses.JSON(w, http.StatusOK, unreadCount{UnreadCount: unread})
+}
+
+// GetNotificationPreferences tells which types of notification the caller
+// gets.
+func (server *Server) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	prefs, err := models.FindNotificationPreferences(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, prefs)
+}
+
+// UpdateNotificationPreferences turns the types of notification in the
+// body, such as {"reaction": false}, on or off for the caller.
+func (server *Server) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	input := notificationPreferences{}
+	if !bind(w, r, &input) {
+		return
+	}
+
+	err = models.SaveNotificationPreferences(server.db(r), uid, input)
+	if err == models.ErrUnknownNotification {
+		responses.Error(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.GetNotificationPreferences(w, r)
+}
+
+// StreamNotifications pushes the caller's new notifications as
+// Server-Sent Events, after the count of unread ones. Clients reconnecting
+// with Last-Event-ID first get those they missed. A comment is sent at
+// every heartbeat, from NOTIFY_HEARTBEAT, to keep proxies from closing
+// idle streams, and the stream ends at the first one after the session is
+// revoked.
+func (server *Server) StreamNotifications(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := auth.ExtractTokenClaims(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	uid := claims.UserID
+	ctx := r.Context()
+	log := logger.FromContext(ctx)
+
+	// Subscribing first, nothing is missed while catching up. Without a
+	// broker, streams look for new notifications at every heartbeat.
+	var events <-chan notify.Event
+	if server.Notifier != nil {
+		events, err = server.Notifier.Subscribe(ctx, uid)
+		if err != nil {
+			responses.Error(w, http.StatusServiceUnavailable, errors.New("Notifications Unavailable"))
+			return
+		}
+	}
+
+	last, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil {
+		last, err = models.LatestNotificationID(server.db(r), uid)
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	unread, err := models.CountUnreadNotifications(server.db(r), uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(data []byte) bool {
+		// Not every writer supports deadlines, those streams end at the
+		// server's write timeout and clients reconnect.
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		_, err := w.Write(data)
+		return err == nil && rc.Flush() == nil
+	}
+	// catchUp sends the notifications after the last one sent.
+	catchUp := func() bool {
+		notifications, err := models.FindNotificationsAfter(server.db(r), uid, last)
+		if err != nil {
+			log.Warn("cannot load notifications", "error", err)
+			return true
+		}
+		for i := range *notifications {
+			n := &(*notifications)[i]
+			event, err := notificationEvent(n)
+			if err != nil || !send(event.Encode()) {
+				return false
+			}
+			last = n.ID
+		}
+		return true
+	}
+
+	if !send(unreadEvent(unread).Encode()) || !catchUp() {
+		return
+	}
+	heartbeat := time.NewTicker(durationFromEnv("NOTIFY_HEARTBEAT", 15*time.Second))
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-server.stopping:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// Notifications are read back from the database, in order and
+			// including any the broker dropped.
+			if event.Name == eventNotification {
+				if !catchUp() {
+					return
+				}
+				continue
+			}
+			if !send(event.Encode()) {
+				return
+			}
+		case <-heartbeat.C:
+			if auth.Sessions != nil {
+				err = auth.Sessions.ValidateSession(claims.ID, uid)
+				if err != nil {
+					log.Info("notification stream closed", "reason", err)
+					return
+				}
+			}
+			if !catchUp() || !send([]byte(": heartbeat\n\n")) {
+				return
+			}
+		}
+	}
+}
+
+func notificationEvent(n *models.Notification) (notify.Event, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return notify.Event{}, err
+	}
+	return notify.Event{ID: strconv.FormatUint(n.ID, 10), Name: eventNotification, Data: data}, nil
+}
+
+func unreadEvent(unread int) notify.Event {
+	data, _ := json.Marshal(unreadCount{UnreadCount: unread})
+	return notify.Event{Name: eventUnread, Data: data}
+}
+
+// notify records the notification and pushes it to the streams of its
+// user. Failures are logged rather than failing the action that caused it.
+func (server *Server) notify(r *http.Request, n *models.Notification) {
+	created, err := n.SaveNotification(server.db(r))
+	if err != nil {
+		logger.FromContext(r.Context()).Error("cannot save notification", "type", n.Type, "error", err)
+		return
+	}
+	if !created {
+		return
+	}
+	event, err := notificationEvent(n)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("cannot encode notification", "error", err)
+		return
+	}
+	server.publish(r, n.UserID, event)
+}
+
+// notifyMentions notifies the users the post mentioned for the first time.
+func (server *Server) notifyMentions(r *http.Request, post *models.Post) {
+	for _, uid := range post.Mentioned {
+		server.notify(r, &models.Notification{UserID: uid, Type: models.NotificationMention, ActorID: post.AuthorID, PostID: &post.ID})
+	}
+}
+
+// publish pushes the event to the streams of the user, if there is a
+// broker. Streams that miss it catch up from the database.
+func (server *Server) publish(r *http.Request, uid uint32, event notify.Event) {
+	if server.Notifier == nil {
+		return
+	}
+	err := server.Notifier.Publish(r.Context(), uid, event)
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("cannot publish notification", "event", event.Name, "error", err)
+	}
+}
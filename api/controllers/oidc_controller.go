@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const (
+	oidcStatePurpose = "oidc_state"
+	oidcStateCookie  = "oidc_state"
+	oidcStateTTL     = 10 * time.Minute
+)
+
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func (server *Server) oidcProvider(r *http.Request) (*auth.OIDCProvider, bool) {
+	p, ok := server.OIDCProviders[strings.ToLower(mux.Vars(r)["provider"])]
+	return p, ok
+}
+
+func (server *Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+
+	provider, ok := server.oidcProvider(r)
+	if !ok {
+		responses.Error(w, http.StatusNotFound, errors.New("Unknown Provider"))
+		return
+	}
+
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	nonce, err := auth.RandomString(16)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := json.Marshal(oidcState{Provider: provider.Name, Nonce: nonce, CodeVerifier: verifier})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	state, _, err := models.IssueOneTimeToken(server.db(r), oidcStatePurpose, provider.Name, string(data), oidcStateTTL)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		responses.Error(w, http.StatusBadGateway, err)
+		return
+	}
+	// The callback only accepts the state in the browser that started the
+	// login, so nobody can log a victim into their own account with it.
+	http.SetCookie(w, oidcStateCookieFor(models.HashToken(state), int(oidcStateTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (server *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+
+	provider, ok := server.oidcProvider(r)
+	if !ok {
+		responses.Error(w, http.StatusNotFound, errors.New("Unknown Provider"))
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		responses.Error(w, http.StatusUnauthorized, fmt.Errorf("%s: %s", e, query.Get("error_description")))
+		return
+	}
+	code := query.Get("code")
+	if code == "" || query.Get("state") == "" {
+		responses.Error(w, http.StatusBadRequest, errors.New("Required Code And State"))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value != models.HashToken(query.Get("state")) {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid State"))
+		return
+	}
+	http.SetCookie(w, oidcStateCookieFor("", -1))
+
+	stored, err := models.ConsumeOneTimeToken(server.db(r), oidcStatePurpose, query.Get("state"))
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid State"))
+		return
+	}
+	state := oidcState{}
+	err = json.Unmarshal([]byte(stored.Data), &state)
+	if err != nil || state.Provider != provider.Name {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Invalid State"))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), code, state.CodeVerifier)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := server.oidcUser(r, provider.Name, claims)
+	if err != nil {
+		responses.Error(w, http.StatusForbidden, err)
+		return
+	}
+
+	token, err := server.issueToken(r, user.ID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if auth.CookiesEnabled() {
+		auth.SetAuthCookies(w, token)
+	}
+	responses.JSON(w, http.StatusOK, token)
+}
+
+// oidcStateCookieFor binds a login to the browser by the hash of its state.
+func oidcStateCookieFor(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/login/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   auth.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oidcUser resolves the local user for an external identity. Identities are
+// linked to existing users by verified email, otherwise a user is
+// provisioned on first login.
+func (server *Server) oidcUser(r *http.Request, provider string, claims *auth.IDTokenClaims) (*models.User, error) {
+
+	identity := models.Identity{}
+	_, err := identity.FindIdentity(server.db(r), provider, claims.Subject)
+	if err == nil {
+		user := models.User{}
+		return user.FindUserByID(server.db(r), identity.UserID)
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &models.User{}, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return &models.User{}, errors.New("Email Not Verified")
+	}
+
+	var user *models.User
+	tx := server.db(r).Begin()
+	user, err = (&models.User{}).FindUserByEmail(tx, claims.Email)
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			tx.Rollback()
+			return &models.User{}, err
+		}
+		user, err = provisionUser(tx, claims)
+		if err != nil {
+			tx.Rollback()
+			return &models.User{}, err
+		}
+	}
+
+	identity = models.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}
+	_, err = identity.SaveIdentity(tx)
+	if err != nil {
+		tx.Rollback()
+		return &models.User{}, err
+	}
+	return user, tx.Commit().Error
+}
+
+// maxProvisionedNickname caps the nicknames made from identity claims,
+// leaving room for the number that tells equal ones apart.
+const maxProvisionedNickname = 32
+
+func provisionUser(db *gorm.DB, claims *auth.IDTokenClaims) (*models.User, error) {
+	base, err := provisionedNickname(claims)
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	nickname := base
+	for i := 2; ; i++ {
+		var count int
+		err := db.Model(&models.User{}).Where("nickname = ?", nickname).Count(&count).Error
+		if err != nil {
+			return &models.User{}, err
+		}
+		if count == 0 && auth.Policy.CheckNickname(nickname) == nil {
+			break
+		}
+		nickname = fmt.Sprintf("%s%d", base, i)
+	}
+
+	// The user signs in through the provider, so the local password is an
+	// unguessable placeholder.
+	password, err := auth.RandomString(32)
+	if err != nil {
+		return &models.User{}, err
+	}
+	user := models.User{
+		Nickname: nickname,
+		Email:    claims.Email,
+		Password: password,
+	}
+	user.Prepare()
+	err = user.Validate("")
+	if err != nil {
+		return &models.User{}, err
+	}
+	return user.SaveUser(db)
+}
+
+// provisionedNickname makes a nickname from the first of the preferred
+// username, the name and the local part of the email that is still
+// allowed once reduced to the characters mentions can refer to. When none
+// is, the nickname is generated.
+func provisionedNickname(claims *auth.IDTokenClaims) (string, error) {
+	for _, name := range []string{claims.PreferredUsername, claims.Name, strings.Split(claims.Email, "@")[0]} {
+		nickname := sanitizeNickname(name)
+		if nickname != "" && auth.Policy.CheckNickname(nickname) == nil {
+			return nickname, nil
+		}
+	}
+	random, err := auth.RandomString(6)
+	if err != nil {
+		return "", err
+	}
+	return "user_" + random, nil
+}
+
+// sanitizeNickname keeps the letters, digits, underscores, dots and dashes
+// of the name, up to maxProvisionedNickname of them, without dots or
+// dashes at either end.
+func sanitizeNickname(name string) string {
+	kept := make([]rune, 0, maxProvisionedNickname)
+	for _, c := range name {
+		if len(kept) == maxProvisionedNickname {
+			break
+		}
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_.-", c) {
+			kept = append(kept, c)
+		}
+	}
+	return strings.Trim(string(kept), ".-")
+}
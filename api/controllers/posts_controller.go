@@ -1,35 +1,47 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/Funskie/blogIris/api/auth"
 	"github.com/Funskie/blogIris/api/models"
 	"github.com/Funskie/blogIris/api/responses"
 	"github.com/Funskie/blogIris/api/utils/formaterror"
-	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 )
 
+// postInput is the body of post creations. The author is always the
+// authenticated user, so clients cannot post in someone else's name.
+type postInput struct {
+	Title   string `json:"title" validate:"required,max=255"`
+	Content string `json:"content" validate:"required"`
+}
+
+// postUpdateInput is the body of post updates, which also carry the version
+// they were based on.
+type postUpdateInput struct {
+	postInput
+	Version uint32 `json:"version"`
+}
+
 func (server *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+	input := postInput{}
+	if !bind(w, r, &input) {
 		return
 	}
 
-	post := models.Post{}
-	err = json.Unmarshal(body, &post)
+	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
 
+	post := models.Post{Title: input.Title, Content: input.Content, AuthorID: uid}
 	post.Prepare()
 	err = post.Validate()
 	if err != nil {
@@ -37,24 +49,16 @@ func (server *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uid, err := auth.ExtractTokenID(r)
-	if err != nil {
-		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-	if uid != post.AuthorID {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
-		return
-	}
-
-	postCreated, err := post.SavePost(server.DB)
+	postCreated, err := post.SavePost(server.db(r))
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.Error(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.invalidatePosts(r)
+	server.notifyMentions(r, postCreated)
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, postCreated.ID))
+	w.Header().Set("Location", server.location(r, "post", "id", strconv.FormatUint(postCreated.ID, 10)))
 	responses.JSON(w, http.StatusCreated, postCreated)
 }
 
@@ -67,25 +71,66 @@ func (server *Server) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post := models.Post{}
-	postReceived, err := post.FindPostByID(server.DB, uint64(pid))
+	uid, signedIn := server.reader(r)
+	resp, err := server.readerPosts(w, r, signedIn, postKey(pid), func() (*cachedResponse, error) {
+		post := models.Post{}
+		postReceived, err := post.FindPostByID(server.db(r), uint64(pid))
+		if err != nil {
+			return nil, err
+		}
+		if signedIn {
+			err = models.LoadBookmarked(server.db(r), uid, postReceived)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newPostsResponse("post", postReceived, *postReceived)
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, postReceived)
+	writeCached(w, r, resp)
 }
 
 func (server *Server) GetPosts(w http.ResponseWriter, r *http.Request) {
 
-	post := models.Post{}
+	fields, err := models.ParsePostFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
 
-	posts, err := post.FindAllPosts(server.DB)
+	key := "list:" + strings.Join(fields, ",")
+	uid, signedIn := server.reader(r)
+	resp, err := server.readerPosts(w, r, signedIn, key, func() (*cachedResponse, error) {
+		post := models.Post{}
+		posts, err := post.FindPosts(server.db(r), fields)
+		if err != nil {
+			return nil, err
+		}
+		if signedIn {
+			err = models.LoadBookmarked(server.db(r), uid, models.PostPointers(*posts)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err := newPostsResponse(key, posts, *posts...)
+		if err != nil {
+			return nil, err
+		}
+		resp.LastModified = server.postsChangedAt(r)
+		return resp, nil
+	})
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, posts)
+	writeCached(w, r, resp)
 }
 
 func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
@@ -98,24 +143,21 @@ func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	post := models.Post{}
-	postInDB, err := post.FindPostByID(server.DB, uint64(pid))
-	if err != nil {
+	postInDB, err := post.FindPostByID(server.db(r), uint64(pid))
+	if gorm.IsRecordNotFoundError(err) {
 		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
 		return
 	}
-
-	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	postUpdate := models.Post{}
-	err = json.Unmarshal(body, &postUpdate)
-	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+	input := postUpdateInput{}
+	if !bind(w, r, &input) {
 		return
 	}
+	postUpdate := models.Post{Title: input.Title, Content: input.Content, AuthorID: postInDB.AuthorID, Version: input.Version}
 
 	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
@@ -123,11 +165,7 @@ func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if uid != postInDB.AuthorID {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
-		return
-	}
-	if uid != postUpdate.AuthorID {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
 
@@ -138,13 +176,31 @@ func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkVersion(w, r, postETag(*postInDB), postInDB.Version, postUpdate.Version, postInDB) {
+		return
+	}
+
 	postUpdate.ID = postInDB.ID
-	postUpdated, err := postUpdate.UpdateAPost(server.DB, uint64(pid))
+	postUpdate.Version = postInDB.Version
+	postUpdated, err := postUpdate.UpdateAPost(server.db(r), uint64(pid))
+	if err == models.ErrVersionConflict {
+		current := models.Post{}
+		_, err = current.FindPostByID(server.db(r), pid)
+		if err != nil {
+			responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
+			return
+		}
+		writeConflict(w, postETag(current), current)
+		return
+	}
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.Error(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.invalidatePosts(r)
+	server.notifyMentions(r, postUpdated)
+	w.Header().Set("ETag", postETag(*postUpdated))
 	responses.JSON(w, http.StatusOK, postUpdated)
 }
 
@@ -158,11 +214,15 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	post := models.Post{}
-	postInDB, err := post.FindPostByID(server.DB, pid)
-	if err != nil {
+	postInDB, err := post.FindPostByID(server.db(r), pid)
+	if gorm.IsRecordNotFoundError(err) {
 		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
 		return
 	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
 
 	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
@@ -170,15 +230,15 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if uid != postInDB.AuthorID {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
 
-	isDelete, err := postInDB.DeleteAPost(server.DB, pid, uid)
+	_, err = postInDB.DeleteAPost(server.db(r), pid, uid)
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", pid))
-	responses.JSON(w, http.StatusNoContent, isDelete)
+	server.invalidatePosts(r)
+	responses.NoContent(w)
 }
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// conflictResponse carries the current state of a record whose update was
+// rejected as stale, so that the client can merge and retry.
+type conflictResponse struct {
+	Error   string      `json:"error"`
+	Current interface{} `json:"current"`
+}
+
+// checkVersion enforces optimistic concurrency on updates. Clients name
+// the version they edited with If-Match and its ETag, answered with 412, or
+// with a version field, answered with 409, when the record has changed
+// since. A version of 0 means none was given. It writes the rejection and
+// returns false when the update must not go ahead.
+func checkVersion(w http.ResponseWriter, r *http.Request, etag string, current, given uint32, state interface{}) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !responses.ETagMatches(ifMatch, etag, false) {
+			w.Header().Set("ETag", etag)
+			responses.JSON(w, http.StatusPreconditionFailed, conflictResponse{Error: "Precondition Failed", Current: state})
+			return false
+		}
+		return true
+	}
+	if given == 0 {
+		responses.Error(w, http.StatusPreconditionRequired, errors.New("Required If-Match Or Version"))
+		return false
+	}
+	if given != current {
+		writeConflict(w, etag, state)
+		return false
+	}
+	return true
+}
+
+func writeConflict(w http.ResponseWriter, etag string, state interface{}) {
+	w.Header().Set("ETag", etag)
+	responses.JSON(w, http.StatusConflict, conflictResponse{Error: models.ErrVersionConflict.Error(), Current: state})
+}
+
+func postETag(p models.Post) string {
+	etag, _ := postValidators("post", p)
+	return etag
+}
+
+func userETag(u models.User) string {
+	return fmt.Sprintf(`"user-%d-%d"`, u.ID, u.Version)
+}
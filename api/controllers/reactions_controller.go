@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// reactionCounts is the answer to reaction changes, the post's counts after
+// the change.
+type reactionCounts struct {
+	PostID    uint64         `json:"post_id"`
+	Reactions map[string]int `json:"reactions"`
+}
+
+// GetReactionKinds lists the reactions readers can leave.
+func (server *Server) GetReactionKinds(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, models.ReactionKinds)
+}
+
+// reactionTarget parses the post ID and reaction kind of the URL and looks
+// up the post, writing the error response when either is invalid. Posts
+// in the trash cannot be reacted to.
+func (server *Server) reactionTarget(w http.ResponseWriter, r *http.Request) (*models.Post, string, bool) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return nil, "", false
+	}
+	kind := vars["kind"]
+	if !models.IsReactionKind(kind) {
+		responses.Error(w, http.StatusBadRequest, models.ErrUnknownReaction)
+		return nil, "", false
+	}
+
+	post := models.Post{}
+	_, err = post.FindPostByID(server.db(r), pid)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
+		return nil, "", false
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return nil, "", false
+	}
+	return &post, kind, true
+}
+
+// writeReactionCounts reloads the counts of the post and writes them.
+func (server *Server) writeReactionCounts(w http.ResponseWriter, r *http.Request, status int, post *models.Post) {
+	err := models.LoadReactionCounts(server.db(r), []*models.Post{post})
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, status, reactionCounts{PostID: post.ID, Reactions: post.Reactions})
+}
+
+// AddReaction leaves the caller's reaction of the kind on the post. Adding
+// it again changes nothing and answers 200 instead of 201.
+func (server *Server) AddReaction(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	post, kind, ok := server.reactionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	reaction := models.Reaction{PostID: post.ID, UserID: uid, Kind: kind}
+	created, err := reaction.SaveReaction(server.db(r))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		server.invalidatePost(r, post.ID)
+		server.notify(r, &models.Notification{UserID: post.AuthorID, Type: models.NotificationReaction, ActorID: uid, PostID: &post.ID, Detail: kind})
+	}
+	server.writeReactionCounts(w, r, status, post)
+}
+
+// DeleteReaction takes back the caller's reaction of the kind.
+func (server *Server) DeleteReaction(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	post, kind, ok := server.reactionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	reaction := models.Reaction{}
+	deleted, err := reaction.DeleteReaction(server.db(r), post.ID, uid, kind)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deleted == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("Reaction not found"))
+		return
+	}
+	server.invalidatePost(r, post.ID)
+	responses.NoContent(w)
+}
+
+// GetReactions lists who reacted to the post, latest first, optionally
+// only with the kind given.
+func (server *Server) GetReactions(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && !models.IsReactionKind(kind) {
+		responses.Error(w, http.StatusBadRequest, models.ErrUnknownReaction)
+		return
+	}
+
+	post := models.Post{}
+	_, err = post.FindPostByID(server.db(r), pid)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	reaction := models.Reaction{}
+	reactions, err := reaction.FindPostReactions(server.db(r), pid, kind)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, reactions)
+}
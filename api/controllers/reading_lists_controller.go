@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// readingListInput is the body of list creations.
+type readingListInput struct {
+	Name   string `json:"name" validate:"required,max=100"`
+	Public bool   `json:"public"`
+}
+
+// readingListUpdate is the body of list updates, which only change the
+// fields they contain.
+type readingListUpdate struct {
+	Name   *string `json:"name" validate:"required,max=100"`
+	Public *bool   `json:"public"`
+}
+
+// readingListPost adds a post to a list, at the end unless a position
+// counting from 0 is given.
+type readingListPost struct {
+	PostID   uint64 `json:"post_id" validate:"required"`
+	Position *int   `json:"position" validate:"min=0"`
+}
+
+// readingListOrder is the new order of every post of a list.
+type readingListOrder struct {
+	PostIDs []uint64 `json:"post_ids"`
+}
+
+var errReadingListNotFound = errors.New("Reading list not found")
+
+// findReadingList looks up the list with the ID in the URL variable, with
+// its posts marked for the reader. Private lists are only found by their
+// owner, anyone else gets 404 as if they did not exist.
+func (server *Server) findReadingList(w http.ResponseWriter, r *http.Request, idVar string) (*models.ReadingList, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars[idVar], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	list := models.ReadingList{}
+	_, err = list.FindReadingListByID(server.db(r), id)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errReadingListNotFound)
+		return nil, false
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	uid, signedIn := server.reader(r)
+	if !list.Public && (!signedIn || uid != list.UserID) {
+		responses.Error(w, http.StatusNotFound, errReadingListNotFound)
+		return nil, false
+	}
+	if signedIn {
+		err = models.LoadBookmarked(server.db(r), uid, models.PostPointers(list.Posts)...)
+		if err != nil {
+			responses.Error(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+	}
+	return &list, true
+}
+
+// ownReadingList is findReadingList for changes, which only the owner may
+// make.
+func (server *Server) ownReadingList(w http.ResponseWriter, r *http.Request) (*models.ReadingList, bool) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	list, ok := server.findReadingList(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+	if list.UserID != uid {
+		responses.Error(w, http.StatusNotFound, errReadingListNotFound)
+		return nil, false
+	}
+	return list, true
+}
+
+// writeReadingList reloads the list after a change and writes it.
+func (server *Server) writeReadingList(w http.ResponseWriter, r *http.Request, status int) {
+	list, ok := server.findReadingList(w, r, "id")
+	if !ok {
+		return
+	}
+	responses.JSON(w, status, list)
+}
+
+// GetMyReadingLists lists the caller's lists, private ones included.
+func (server *Server) GetMyReadingLists(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	list := models.ReadingList{}
+	lists, err := list.FindUserReadingLists(server.db(r), uid, true)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, lists)
+}
+
+func (server *Server) CreateReadingList(w http.ResponseWriter, r *http.Request) {
+
+	input := readingListInput{}
+	if !bind(w, r, &input) {
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	list := models.ReadingList{UserID: uid, Name: input.Name, Public: input.Public}
+	listCreated, err := list.SaveReadingList(server.db(r))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	listCreated.Posts = []models.Post{}
+
+	w.Header().Set("Location", server.location(r, "reading-list", "id", strconv.FormatUint(listCreated.ID, 10)))
+	responses.JSON(w, http.StatusCreated, listCreated)
+}
+
+func (server *Server) GetMyReadingList(w http.ResponseWriter, r *http.Request) {
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+	responses.JSON(w, http.StatusOK, list)
+}
+
+func (server *Server) UpdateReadingList(w http.ResponseWriter, r *http.Request) {
+
+	input := readingListUpdate{}
+	if !bind(w, r, &input) {
+		return
+	}
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+	listUpdated, err := list.UpdateReadingList(server.db(r))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, listUpdated)
+}
+
+func (server *Server) DeleteReadingList(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+	_, err := list.DeleteReadingList(server.db(r), list.ID, list.UserID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.NoContent(w)
+}
+
+// AddReadingListPost puts a post in the caller's list. Adding a listed
+// post again leaves it in place and answers 200 instead of 201.
+func (server *Server) AddReadingListPost(w http.ResponseWriter, r *http.Request) {
+
+	input := readingListPost{}
+	if !bind(w, r, &input) {
+		return
+	}
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	post := models.Post{}
+	_, err := post.FindPostByID(server.db(r), input.PostID)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusUnprocessableEntity, errors.New("Post not found"))
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	position := -1
+	if input.Position != nil {
+		position = *input.Position
+	}
+	added, err := list.AddPost(server.db(r), input.PostID, position)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	server.writeReadingList(w, r, status)
+}
+
+func (server *Server) RemoveReadingListPost(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["post_id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	removed, err := list.RemovePost(server.db(r), pid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if removed == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("Post not in the reading list"))
+		return
+	}
+	responses.NoContent(w)
+}
+
+// ReorderReadingList puts the posts of the caller's list in a new order.
+func (server *Server) ReorderReadingList(w http.ResponseWriter, r *http.Request) {
+
+	input := readingListOrder{}
+	if !bind(w, r, &input) {
+		return
+	}
+	list, ok := server.ownReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	err := list.ReorderPosts(server.db(r), input.PostIDs)
+	if err == models.ErrReadingListOrder {
+		responses.Error(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.writeReadingList(w, r, http.StatusOK)
+}
+
+// GetUserReadingLists lists the public lists of a user.
+func (server *Server) GetUserReadingLists(w http.ResponseWriter, r *http.Request) {
+
+	uid, ok := server.findListOwner(w, r)
+	if !ok {
+		return
+	}
+
+	list := models.ReadingList{}
+	lists, err := list.FindUserReadingLists(server.db(r), uid, false)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, lists)
+}
+
+// GetUserReadingList shows a public list of a user, or a private one to its
+// owner.
+func (server *Server) GetUserReadingList(w http.ResponseWriter, r *http.Request) {
+
+	uid, ok := server.findListOwner(w, r)
+	if !ok {
+		return
+	}
+	list, ok := server.findReadingList(w, r, "list_id")
+	if !ok {
+		return
+	}
+	if list.UserID != uid {
+		responses.Error(w, http.StatusNotFound, errReadingListNotFound)
+		return
+	}
+	responses.JSON(w, http.StatusOK, list)
+}
+
+// findListOwner finds the user of the {id} route variable, whose lists
+// are hidden while they are in the trash.
+func (server *Server) findListOwner(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	user := models.User{}
+	_, err = user.FindUserByID(server.db(r), uint32(uid))
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return 0, false
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	return uint32(uid), true
+}
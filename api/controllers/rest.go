@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/requests"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// SetupRouter builds the router with every route of the API.
+func (server *Server) SetupRouter() {
+	server.Router = mux.NewRouter()
+	server.initializeRoutes()
+}
+
+// location returns the absolute URL of a named route, for the Location
+// header of created resources. It is empty if the route is unknown.
+func (server *Server) location(r *http.Request, name string, pairs ...string) string {
+	if server.Router == nil {
+		return ""
+	}
+	route := server.Router.Get(name)
+	if route == nil {
+		return ""
+	}
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return ""
+	}
+	return baseURL(r) + u.Path
+}
+
+// baseURL is APP_URL, or the scheme and host the request was made to when
+// it is not set.
+func baseURL(r *http.Request) string {
+	if base := os.Getenv("APP_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// allowMethods are the methods tried when listing what a path supports.
+var allowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// allowed returns the methods the router has a route for at the request's
+// path.
+func (server *Server) allowed(r *http.Request) []string {
+	var methods []string
+	for _, method := range allowMethods {
+		req := r.Clone(r.Context())
+		req.Method = method
+		var match mux.RouteMatch
+		if server.Router.Match(req, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// methodNotAllowed answers requests whose path exists but not with their
+// method, listing the supported methods in the Allow header.
+func (server *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(append(server.allowed(r), "OPTIONS"), ", "))
+	responses.Error(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+}
+
+// options lists the methods of a path, and answers CORS preflights for it.
+func (server *Server) options(w http.ResponseWriter, r *http.Request) {
+	methods := server.allowed(r)
+	if len(methods) == 0 {
+		notFound(w, r)
+		return
+	}
+	methods = append(methods, "OPTIONS")
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	server.CORS.Preflight(w, r, methods)
+	responses.NoContent(w)
+}
+
+// bind decodes the request body into the input, answering the request
+// itself when the body cannot be bound.
+func bind(w http.ResponseWriter, r *http.Request, input interface{}) bool {
+	err := requests.Bind(w, r, input)
+	if err != nil {
+		status := http.StatusBadRequest
+		if bindErr, ok := err.(*requests.Error); ok {
+			status = bindErr.Status
+		}
+		responses.Error(w, status, err)
+		return false
+	}
+	return true
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	responses.Error(w, http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+}
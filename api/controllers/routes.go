@@ -1,26 +1,147 @@
 package controllers
 
-import "github.com/Funskie/blogIris/api/middlewares"
+import (
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/metrics"
+	"github.com/Funskie/blogIris/api/middlewares"
+)
+
+// Posts may be stored by any cache but must be revalidated, which is cheap
+// with their ETags.
+const postsCacheControl = "public, no-cache"
+
+// Body size limits of the routes taking small forms, such as credentials
+// and profiles. Posts get requests.DefaultMaxBodySize.
+const formBodySize = 16 << 10
 
 func (s *Server) initializeRoutes() {
 
+	// Every request, including unmatched ones, gets a request ID, metrics, a
+	// trace, an access log entry, panic recovery, the security and CORS
+	// headers, the default rate limit and CSRF protection.
+	global := []mux.MiddlewareFunc{
+		middlewares.SetMiddlewareRequestID,
+		middlewares.SetMiddlewareMetrics,
+		middlewares.SetMiddlewareTracing,
+		middlewares.SetMiddlewareLogger,
+		middlewares.SetMiddlewareRecovery,
+		middlewares.SecurityHeaders(),
+		s.CORS.Middleware,
+		s.RateLimiter.Middleware("default", middlewares.ByClient),
+		middlewares.SetMiddlewareCSRF,
+	}
+	limit := s.RateLimiter.Limit
+	s.Router.Use(global...)
+
+	// Unmatched requests get JSON errors like every other response, with the
+	// supported methods in Allow when only the method is wrong.
+	unmatched := append(global[:len(global):len(global)], middlewares.SetMiddlewareJSON)
+	s.Router.NotFoundHandler = middlewares.Chain(http.HandlerFunc(notFound), unmatched...)
+	s.Router.MethodNotAllowedHandler = middlewares.Chain(http.HandlerFunc(s.methodNotAllowed), unmatched...)
+
+	public := s.Router.NewRoute().Subrouter()
+	public.Use(middlewares.SetMiddlewareJSON)
+
+	// Preflight and OPTIONS requests for every path
+	public.Methods("OPTIONS").HandlerFunc(s.options)
+
+	private := s.Router.NewRoute().Subrouter()
+	private.Use(middlewares.SetMiddlewareJSON, middlewares.SetMiddlewareAuthentication, middlewares.SetMiddlewareNoStore)
+
+	// Feeds also accept signed URLs, for readers that cannot log in.
+	feeds := s.Router.NewRoute().Subrouter()
+	feeds.Use(middlewares.SetMiddlewareJSON, allowSignedURLs, middlewares.SetMiddlewareAuthentication, middlewares.SetMiddlewareNoStore)
+
+	// Metrics Route, unless they are served on their own listener
+	if os.Getenv("METRICS_ADDR") == "" {
+		s.Router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	}
+
+	// Health Routes
+	public.HandleFunc("/healthz", s.Healthz).Methods("GET")
+	public.HandleFunc("/readyz", s.Readyz).Methods("GET")
+
 	// Home Route
-	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
+	public.HandleFunc("/", s.Home).Methods("GET")
 
-	// Login Route
-	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
+	// Login Routes
+	public.HandleFunc("/login", limit("login", middlewares.ByIP, middlewares.CountLogins(metrics.LoginPassword, middlewares.SetMaxBodySize(formBodySize, s.Login)))).Methods("POST")
+	public.HandleFunc("/login/magic", limit("login", middlewares.ByIP, middlewares.SetMaxBodySize(formBodySize, s.RequestMagicLink))).Methods("POST")
+	public.HandleFunc("/login/magic/verify", middlewares.CountLogins(metrics.LoginMagicLink, s.VerifyMagicLink)).Methods("GET")
+	s.Router.HandleFunc("/login/oidc/{provider}", s.OIDCLogin).Methods("GET")
+	public.HandleFunc("/login/oidc/{provider}/callback", middlewares.CountLogins(metrics.LoginOIDC, s.OIDCCallback)).Methods("GET")
 
 	// Users Routes
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(s.GetUser)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
+	public.HandleFunc("/users", limit("signup", middlewares.ByIP, middlewares.SetMaxBodySize(formBodySize, s.CreateUser))).Methods("POST")
+	public.HandleFunc("/users", s.GetUsers).Methods("GET")
+	private.HandleFunc("/users/me/sessions", s.GetSessions).Methods("GET")
+	private.HandleFunc("/users/me/sessions", s.DeleteSessions).Methods("DELETE")
+	private.HandleFunc("/users/me/sessions/{id}", s.DeleteSession).Methods("DELETE")
+	public.HandleFunc("/users/{id}", s.GetUser).Methods("GET").Name("user")
+	private.HandleFunc("/users/{id}", middlewares.SetMaxBodySize(formBodySize, s.UpdateUser)).Methods("PUT", "PATCH")
+	private.HandleFunc("/users/{id}", s.DeleteUser).Methods("DELETE")
+	private.HandleFunc("/users/{id}/password", middlewares.SetMaxBodySize(formBodySize, s.UpdatePassword)).Methods("POST")
+	private.HandleFunc("/users/{id}/restore", s.RestoreUser).Methods("POST")
+
+	// Bookmarks and Reading Lists Routes, the public ones take numeric IDs
+	// only to leave /users/me to the caller's own.
+	private.HandleFunc("/users/me/bookmarks", s.GetBookmarks).Methods("GET")
+	private.HandleFunc("/users/me/bookmarks/{id}", s.AddBookmark).Methods("PUT")
+	private.HandleFunc("/users/me/bookmarks/{id}", s.DeleteBookmark).Methods("DELETE")
+	private.HandleFunc("/users/me/lists", s.GetMyReadingLists).Methods("GET")
+	private.HandleFunc("/users/me/lists", middlewares.SetMaxBodySize(formBodySize, s.CreateReadingList)).Methods("POST")
+	private.HandleFunc("/users/me/lists/{id}", s.GetMyReadingList).Methods("GET").Name("reading-list")
+	private.HandleFunc("/users/me/lists/{id}", middlewares.SetMaxBodySize(formBodySize, s.UpdateReadingList)).Methods("PATCH")
+	private.HandleFunc("/users/me/lists/{id}", s.DeleteReadingList).Methods("DELETE")
+	private.HandleFunc("/users/me/lists/{id}/posts", middlewares.SetMaxBodySize(formBodySize, s.AddReadingListPost)).Methods("POST")
+	private.HandleFunc("/users/me/lists/{id}/posts", s.ReorderReadingList).Methods("PUT")
+	private.HandleFunc("/users/me/lists/{id}/posts/{post_id}", s.RemoveReadingListPost).Methods("DELETE")
+	public.HandleFunc("/users/{id:[0-9]+}/lists", s.GetUserReadingLists).Methods("GET")
+	public.HandleFunc("/users/{id:[0-9]+}/lists/{list_id}", s.GetUserReadingList).Methods("GET")
+
+	// Follows Routes
+	private.HandleFunc("/users/{id}/follow", s.FollowUser).Methods("POST")
+	private.HandleFunc("/users/{id}/follow", s.UnfollowUser).Methods("DELETE")
+	public.HandleFunc("/users/{id}/followers", s.GetFollowers).Methods("GET")
+	public.HandleFunc("/users/{id}/following", s.GetFollowing).Methods("GET")
+
+	// Timeline Routes
+	feeds.HandleFunc("/timeline", s.GetTimeline).Methods("GET")
+	private.HandleFunc("/timeline/link", s.CreateTimelineLink).Methods("POST")
+
+	// Notifications Routes
+	private.HandleFunc("/notifications", s.GetNotifications).Methods("GET")
+	private.HandleFunc("/notifications/read-all", s.ReadAllNotifications).Methods("POST")
+	private.HandleFunc("/notifications/preferences", s.GetNotificationPreferences).Methods("GET")
+	private.HandleFunc("/notifications/preferences", middlewares.SetMaxBodySize(formBodySize, s.UpdateNotificationPreferences)).Methods("PATCH")
+	private.HandleFunc("/notifications/stream", s.StreamNotifications).Methods("GET")
+	private.HandleFunc("/notifications/{id}/read", s.ReadNotification).Methods("POST")
 
 	// Posts Routes
-	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.CreatePost)).Methods("POST")
-	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.GetPosts)).Methods("GET")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareJSON(s.GetPost)).Methods("GET")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePost))).Methods("PUT")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(s.DeletePost)).Methods("DELETE")
+	public.HandleFunc("/posts", limit("posts", middlewares.ByClient, s.CreatePost)).Methods("POST")
+	public.HandleFunc("/posts", middlewares.SetCacheControl(postsCacheControl, s.GetPosts)).Methods("GET")
+	public.HandleFunc("/posts/{id}", middlewares.SetCacheControl(postsCacheControl, s.GetPost)).Methods("GET").Name("post")
+	private.HandleFunc("/posts/{id}", s.UpdatePost).Methods("PUT")
+	private.HandleFunc("/posts/{id}", s.DeletePost).Methods("DELETE")
+	private.HandleFunc("/posts/{id}/restore", s.RestorePost).Methods("POST")
+
+	// Reactions Routes
+	public.HandleFunc("/reactions", s.GetReactionKinds).Methods("GET")
+	public.HandleFunc("/posts/{id}/reactions", s.GetReactions).Methods("GET")
+	private.HandleFunc("/posts/{id}/reactions/{kind}", s.AddReaction).Methods("POST")
+	private.HandleFunc("/posts/{id}/reactions/{kind}", s.DeleteReaction).Methods("DELETE")
+
+	// Trash Routes
+	private.HandleFunc("/trash/posts", s.GetTrashedPosts).Methods("GET")
+	private.HandleFunc("/trash/users", s.GetTrashedUsers).Methods("GET")
+}
+
+// allowSignedURLs lets signed URLs authenticate the requests of a router.
+func allowSignedURLs(next http.Handler) http.Handler {
+	return auth.AllowSignedURLs(next.ServeHTTP)
 }
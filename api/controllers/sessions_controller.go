@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// truncateUTF8 cuts s to at most n bytes of valid UTF-8, without splitting
+// a character. Invalid bytes are dropped, the database would refuse them.
+func truncateUTF8(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// issueToken records a new session for the user and returns a token bound
+// to it. The request is optional and only used for the device details.
+func (server *Server) issueToken(r *http.Request, uid uint32) (string, error) {
+	jti, err := auth.RandomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	session := models.Session{
+		JTI:       jti,
+		UserID:    uid,
+		ExpiresAt: time.Now().Add(auth.TokenLifetime),
+	}
+	if r != nil {
+		session.UserAgent = truncateUTF8(r.UserAgent(), 255)
+		session.IP = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			session.IP = host
+		}
+	}
+	_, err = session.SaveSession(server.db(r))
+	if err != nil {
+		return "", err
+	}
+	return auth.CreateToken(uid, jti)
+}
+
+func (server *Server) GetSessions(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := auth.ExtractTokenClaims(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	session := models.Session{}
+	sessions, err := session.FindUserSessions(server.db(r), claims.UserID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].JTI == claims.ID
+	}
+	responses.JSON(w, http.StatusOK, sessions)
+}
+
+func (server *Server) DeleteSession(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	sid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	session := models.Session{}
+	revoked, err := session.RevokeSession(server.db(r), sid, uid)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if revoked == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("Session not found"))
+		return
+	}
+	responses.NoContent(w)
+}
+
+// DeleteSessions logs the user out everywhere, including the current session.
+func (server *Server) DeleteSessions(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	session := models.Session{}
+	_, err = session.RevokeUserSessions(server.db(r), uid, "")
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if auth.CookiesEnabled() {
+		auth.ClearAuthCookies(w)
+	}
+	responses.NoContent(w)
+}
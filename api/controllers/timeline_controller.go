@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const (
+	timelinePageSize    = 20
+	timelineMaxPageSize = 100
+)
+
+// timelinePage is a page of the timeline. NextCursor is missing on the
+// last page.
+type timelinePage struct {
+	Posts      []models.Post `json:"posts"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// timelineLink is a signed URL of the caller's timeline, for readers that
+// cannot log in such as feed readers.
+type timelineLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetTimeline lists the posts of the caller and of the authors they
+// follow, newest first. The next page is requested with the cursor of the
+// previous one, also given in a Link header.
+func (server *Server) GetTimeline(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	query := r.URL.Query()
+	limit := timelinePageSize
+	if param := query.Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > timelineMaxPageSize {
+			responses.Error(w, http.StatusBadRequest, errors.New("Limit Must Be Between 1 And 100"))
+			return
+		}
+	}
+	cursor, err := models.ParseTimelineCursor(query.Get("cursor"))
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	posts, next, err := models.FindTimeline(server.db(r), uid, cursor, limit)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.LoadBookmarked(server.db(r), uid, models.PostPointers(*posts)...)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := timelinePage{Posts: *posts}
+	if next != nil {
+		page.NextCursor = next.String()
+		// The rest of the query is kept, so signed URLs stay signed.
+		query.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", `<`+baseURL(r)+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+	}
+	responses.JSON(w, http.StatusOK, page)
+}
+
+// CreateTimelineLink signs a URL of the caller's timeline, valid for the
+// ttl given as a duration such as 24h and at most SIGNED_URL_MAX_TTL, and
+// while the caller's session is.
+func (server *Server) CreateTimelineLink(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := auth.ExtractTokenClaims(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	ttl := auth.SignedURLMaxTTL()
+	if param := r.URL.Query().Get("ttl"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 || d > ttl {
+			responses.Error(w, http.StatusBadRequest, errors.New("Invalid TTL, The Maximum Is "+ttl.String()))
+			return
+		}
+		ttl = d
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	// The session lives as long as the link, so that it is listed and can
+	// be revoked until the link expires.
+	session := models.Session{}
+	err = session.ExtendSession(server.db(r), claims.ID, claims.UserID, expires)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	link := timelineLink{
+		URL:       baseURL(r) + "/timeline?" + auth.SignURL("/timeline", claims.UserID, claims.ID, expires).Encode(),
+		ExpiresAt: expires,
+	}
+	responses.JSON(w, http.StatusCreated, link)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// isAdmin reports whether the user may manage everyone's trash. Admins are
+// flagged directly in the users table.
+func (server *Server) isAdmin(r *http.Request, uid uint32) bool {
+	user := models.User{}
+	_, err := user.FindUserByID(server.db(r), uid)
+	return err == nil && user.Admin
+}
+
+// GetTrashedPosts lists the caller's deleted posts. Admins see every
+// deleted post, or those of the author_id given.
+func (server *Server) GetTrashedPosts(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	authorID := uid
+	if server.isAdmin(r, uid) {
+		authorID = 0
+		if param := r.URL.Query().Get("author_id"); param != "" {
+			id, err := strconv.ParseUint(param, 10, 32)
+			if err != nil {
+				responses.Error(w, http.StatusBadRequest, err)
+				return
+			}
+			authorID = uint32(id)
+		}
+	}
+
+	post := models.Post{}
+	posts, err := post.FindDeletedPosts(server.db(r), authorID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, posts)
+}
+
+func (server *Server) GetTrashedUsers(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !server.isAdmin(r, uid) {
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	user := models.User{}
+	users, err := user.FindDeletedUsers(server.db(r))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, users)
+}
+
+func (server *Server) RestorePost(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	post := models.Post{}
+	_, err = post.FindDeletedPost(server.db(r), pid)
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, models.ErrPostNotInTrash)
+		return
+	}
+	if post.AuthorID != uid && !server.isAdmin(r, uid) {
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	postRestored, err := post.RestorePost(server.db(r), pid)
+	switch err {
+	case nil:
+	case models.ErrPostNotInTrash:
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	case models.ErrAuthorInTrash:
+		responses.Error(w, http.StatusConflict, err)
+		return
+	default:
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.invalidatePosts(r)
+	responses.JSON(w, http.StatusOK, postRestored)
+}
+
+// RestoreUser is for admins only, as deleted users cannot log in.
+func (server *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !server.isAdmin(r, tokenID) {
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return
+	}
+
+	user := models.User{}
+	userRestored, err := user.RestoreUser(server.db(r), uint32(uid))
+	if err == models.ErrUserNotInTrash {
+		responses.Error(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.invalidatePosts(r)
+	responses.JSON(w, http.StatusOK, userRestored)
+}
+
+// purgeTrash permanently removes what has been in the trash for longer
+// than TRASH_RETENTION_DAYS (30 by default, 0 keeps it forever), checking
+// every TRASH_PURGE_INTERVAL until the context ends.
+func (server *Server) purgeTrash(ctx context.Context) {
+	days := 30
+	if n, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil {
+		days = n
+	}
+	if days <= 0 {
+		return
+	}
+	ticker := time.NewTicker(durationFromEnv("TRASH_PURGE_INTERVAL", time.Hour))
+	defer ticker.Stop()
+
+	for {
+		posts, users, err := models.PurgeDeleted(server.DB, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			slog.Error("Cannot purge trash", "error", err)
+		} else if posts > 0 || users > 0 {
+			slog.Info("Purged trash", "posts", posts, "users", users)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 
 	"github.com/Funskie/blogIris/api/auth"
 	"github.com/Funskie/blogIris/api/models"
@@ -16,36 +14,36 @@ import (
 	"github.com/Funskie/blogIris/api/utils/formaterror"
 )
 
-func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+// userInput is the body of signups.
+type userInput struct {
+	Nickname string `json:"nickname" validate:"required,max=255"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"required"`
+}
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	user := models.User{}
+func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 
-	err = json.Unmarshal(body, &user)
-	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+	input := userInput{}
+	if !bind(w, r, &input) {
 		return
 	}
 
+	user := models.User{Nickname: input.Nickname, Email: input.Email, Password: input.Password}
 	user.Prepare()
-	err = user.Validate("")
+	err := user.Validate("")
 	if err != nil {
 		responses.Error(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	userCreated, err := user.SaveUser(server.DB)
+	userCreated, err := user.SaveUser(server.db(r))
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		responses.Error(w, http.StatusInternalServerError, formattedError)
 		return
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/&d", r.Host, r.RequestURI, userCreated.ID))
+	w.Header().Set("Location", server.location(r, "user", "id", strconv.FormatUint(uint64(userCreated.ID), 10)))
 	responses.JSON(w, http.StatusCreated, userCreated)
 }
 
@@ -53,7 +51,7 @@ func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 	user := models.User{}
 
-	users, err := user.FindAllUsers(server.DB)
+	users, err := user.FindAllUsers(server.db(r))
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
@@ -71,14 +69,31 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := models.User{}
-	userGotten, err := user.FindUserByID(server.DB, uint32(uid))
+	userGotten, err := user.FindUserByID(server.db(r), uint32(uid))
+	if gorm.IsRecordNotFoundError(err) {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
 	if err != nil {
-		responses.Error(w, http.StatusBadRequest, err)
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	// The ETag is what updates send back in If-Match.
+	if responses.NotModified(w, r, userETag(*userGotten), userGotten.UpdatedAt) {
 		return
 	}
+	responses.SetValidators(w, userETag(*userGotten), userGotten.UpdatedAt)
 	responses.JSON(w, http.StatusOK, userGotten)
 }
 
+// userProfileUpdate has pointer fields so that PATCH-style requests only
+// change the fields they contain.
+type userProfileUpdate struct {
+	Nickname *string `json:"nickname" validate:"required,max=255"`
+	Email    *string `json:"email" validate:"required,email,max=100"`
+	Version  uint32  `json:"version"`
+}
+
 func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -88,43 +103,139 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	update := userProfileUpdate{}
+	if !bind(w, r, &update) {
+		return
+	}
+
+	tokenID, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.Error(w, http.StatusUnprocessableEntity, err)
+		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if tokenID != uint32(uid) {
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
 
 	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	_, err = user.FindUserByID(server.db(r), uint32(uid))
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+
+	// Only the submitted fields are sanitized, the stored ones already were.
+	input := models.User{}
+	if update.Nickname != nil {
+		input.Nickname = *update.Nickname
+	}
+	if update.Email != nil {
+		input.Email = *update.Email
+	}
+	input.Prepare()
+	if update.Nickname != nil {
+		user.Nickname = input.Nickname
+	}
+	if update.Email != nil {
+		user.Email = input.Email
+	}
+
+	err = user.Validate("update")
 	if err != nil {
 		responses.Error(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	tokenID, err := auth.ExtractTokenID(r)
+	if !checkVersion(w, r, userETag(user), user.Version, update.Version, user) {
+		return
+	}
+
+	updatedUser, err := user.UpdateAUser(server.db(r), uint32(uid))
+	if err == models.ErrVersionConflict {
+		current := models.User{}
+		_, err = current.FindUserByID(server.db(r), uint32(uid))
+		if err != nil {
+			responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+			return
+		}
+		writeConflict(w, userETag(current), current)
+		return
+	}
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.Error(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	server.invalidatePosts(r)
+	w.Header().Set("ETag", userETag(*updatedUser))
+	responses.JSON(w, http.StatusOK, updatedUser)
+}
+
+type passwordUpdate struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+func (server *Server) UpdatePassword(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	input := passwordUpdate{}
+	if !bind(w, r, &input) {
+		return
+	}
+
+	claims, err := auth.ExtractTokenClaims(r)
 	if err != nil {
 		responses.Error(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	if tokenID != uint32(uid) {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	if claims.UserID != uint32(uid) {
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
 
-	user.Prepare()
-	err = user.Validate("update")
+	newPassword := models.User{Password: input.NewPassword}
+	err = newPassword.Validate("password")
 	if err != nil {
 		responses.Error(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	updatedUser, err := user.UpdateAUser(server.DB, uint32(uid))
+	user := models.User{}
+	_, err = user.FindUserByID(server.db(r), uint32(uid))
+	if err != nil {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+	err = models.VerifyPasswordContext(r.Context(), user.Password, input.CurrentPassword)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
-		responses.Error(w, http.StatusInternalServerError, formattedError)
+		responses.Error(w, http.StatusUnprocessableEntity, formattedError)
 		return
 	}
-	responses.JSON(w, http.StatusOK, updatedUser)
+
+	err = user.UpdatePassword(server.db(r), input.NewPassword)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.invalidatePosts(r)
+
+	// A new password logs out every other device.
+	session := models.Session{}
+	_, err = session.RevokeUserSessions(server.db(r), uint32(uid), claims.ID)
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.NoContent(w)
 }
 
 func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -144,15 +255,26 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if tokenID != 0 && tokenID != uint32(uid) {
-		responses.Error(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		responses.Error(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
 
-	isDelete, err := user.DeleteAUser(server.DB, uint32(uid))
+	isDelete, err := user.DeleteAUser(server.db(r), uint32(uid))
+	if err != nil {
+		responses.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if isDelete == 0 {
+		responses.Error(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+	// Deleted users are logged out everywhere.
+	session := models.Session{}
+	_, err = session.RevokeUserSessions(server.db(r), uint32(uid), "")
 	if err != nil {
 		responses.Error(w, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
-	responses.JSON(w, http.StatusNoContent, isDelete)
+	server.invalidatePosts(r)
+	responses.NoContent(w)
 }
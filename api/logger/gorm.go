@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GormLogger adapts slog to the gorm logger interface. gorm must run with
+// LogMode(true) for queries to reach it; they are then only logged when
+// LogSQL is set or when they are slower than SlowThreshold.
+type GormLogger struct {
+	Logger        *slog.Logger
+	LogSQL        bool
+	SlowThreshold time.Duration
+}
+
+func NewGormLogger(l *slog.Logger, c Config) *GormLogger {
+	return &GormLogger{Logger: l, LogSQL: c.LogSQL, SlowThreshold: c.SlowThreshold}
+}
+
+var secretPattern = regexp.MustCompile(`^(\$argon2|\$2[aby]\$|[0-9a-f]{64}$)`)
+
+// Redact hides bound parameters that hold password or token hashes.
+func Redact(v interface{}) interface{} {
+	switch s := v.(type) {
+	case string:
+		if secretPattern.MatchString(s) {
+			return "[REDACTED]"
+		}
+	case *string:
+		if s != nil {
+			return Redact(*s)
+		}
+	case []byte:
+		return Redact(string(s))
+	}
+	return v
+}
+
+func (g *GormLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+	level, _ := values[0].(string)
+	source := fmt.Sprint(values[1])
+
+	switch {
+	case level == "sql" && len(values) >= 6:
+		duration, _ := values[2].(time.Duration)
+		slow := g.SlowThreshold > 0 && duration >= g.SlowThreshold
+		if !slow && !g.LogSQL {
+			return
+		}
+		vars, _ := values[4].([]interface{})
+		params := make([]interface{}, len(vars))
+		for i, v := range vars {
+			params[i] = Redact(v)
+		}
+		attrs := []slog.Attr{
+			slog.String("sql", strings.TrimSpace(fmt.Sprint(values[3]))),
+			slog.Any("params", params),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			slog.Any("rows", values[5]),
+			slog.String("source", source),
+		}
+		if slow {
+			g.Logger.LogAttrs(context.Background(), slog.LevelWarn, "slow query", attrs...)
+			return
+		}
+		g.Logger.LogAttrs(context.Background(), slog.LevelDebug, "query", attrs...)
+	default:
+		g.Logger.Error("database", "error", fmt.Sprint(values[2:]...), "source", source)
+	}
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const loggerKey contextKey = 0
+
+// Config is read from LOG_LEVEL (debug, info, warn, error), LOG_FORMAT
+// (json or text), LOG_SQL to log every query at debug level and
+// LOG_SLOW_QUERY for the duration above which queries are logged as slow.
+type Config struct {
+	Level         slog.Level
+	Format        string
+	LogSQL        bool
+	SlowThreshold time.Duration
+}
+
+func ConfigFromEnv() Config {
+	c := Config{
+		Level:         slog.LevelInfo,
+		Format:        "json",
+		SlowThreshold: 200 * time.Millisecond,
+	}
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		c.Level = slog.LevelDebug
+	case "warn", "warning":
+		c.Level = slog.LevelWarn
+	case "error":
+		c.Level = slog.LevelError
+	}
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "text" {
+		c.Format = "text"
+	}
+	c.LogSQL, _ = strconv.ParseBool(os.Getenv("LOG_SQL"))
+	if d, err := time.ParseDuration(os.Getenv("LOG_SLOW_QUERY")); err == nil {
+		c.SlowThreshold = d
+	}
+	return c
+}
+
+func New(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// Setup installs the configured logger as the default one. Messages written
+// through the standard log package go through it as well.
+func Setup(c Config) *slog.Logger {
+	l := New(os.Stdout, c.Level, c.Format)
+	slog.SetDefault(l)
+	return l
+}
+
+// WithContext returns a copy of ctx carrying the logger.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the request scoped logger, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every collector of the application. It is separate from
+// the prometheus default registry so that tests can scrape it in isolation.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_queries_total",
+		Help: "Database queries by operation, table and outcome.",
+	}, []string{"operation", "table", "result"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Database query latency by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts by method and result.",
+	}, []string{"method", "result"})
+
+	tokenFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_validation_failures_total",
+		Help: "Rejected access tokens by reason.",
+	}, []string{"reason"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected by a rate limit policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		dbQueries, dbDuration,
+		logins, tokenFailures,
+		rateLimited,
+	)
+}
+
+// UnmatchedRoute labels requests that matched no route, so that probing
+// random paths cannot grow the number of series.
+const UnmatchedRoute = "unmatched"
+
+func ObserveRequest(method, route string, status int, d time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(d.Seconds())
+}
+
+// Login methods counted by ObserveLogin.
+const (
+	LoginPassword  = "password"
+	LoginMagicLink = "magic_link"
+	LoginOIDC      = "oidc"
+)
+
+func ObserveLogin(method string, ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	logins.WithLabelValues(method, result).Inc()
+}
+
+// ObserveTokenFailure counts a rejected token. The reason should come from
+// a small fixed set, such as "missing", "invalid" or "revoked".
+func ObserveTokenFailure(reason string) {
+	tokenFailures.WithLabelValues(reason).Inc()
+}
+
+func ObserveRateLimited(policy string) {
+	rateLimited.WithLabelValues(policy).Inc()
+}
+
+// RegisterDB adds the connection pool statistics of the database. Calling
+// it again for the same database name is a no-op.
+func RegisterDB(db *sql.DB, name string) {
+	err := Registry.Register(collectors.NewDBStatsCollector(db, name))
+	if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+		panic(err)
+	}
+}
+
+const startKey = "metrics:start"
+
+// RegisterGormCallbacks times every query the gorm handle runs.
+func RegisterGormCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("metrics:before_create", before)
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("metrics:after_create", after("create"))
+	cb.Query().Before("gorm:query").Register("metrics:before_query", before)
+	cb.Query().After("gorm:after_query").Register("metrics:after_query", after("query"))
+	cb.Update().Before("gorm:begin_transaction").Register("metrics:before_update", before)
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("metrics:after_update", after("update"))
+	cb.Delete().Before("gorm:begin_transaction").Register("metrics:before_delete", before)
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("metrics:after_delete", after("delete"))
+	cb.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", before)
+	cb.RowQuery().After("gorm:row_query").Register("metrics:after_row_query", after("row_query"))
+}
+
+func before(scope *gorm.Scope) {
+	scope.Set(startKey, time.Now())
+}
+
+func after(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(startKey)
+		if !ok {
+			return
+		}
+		start, _ := v.(time.Time)
+		table := scope.TableName()
+		if table == "" {
+			table = "unknown"
+		}
+		result := "success"
+		if scope.HasError() && !gorm.IsRecordNotFoundError(scope.DB().Error) {
+			result = "error"
+		}
+		dbQueries.WithLabelValues(operation, table, result).Inc()
+		dbDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus exposition format. With
+// METRICS_USERNAME and METRICS_PASSWORD set, scrapes need basic auth.
+func Handler() http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	username, password := os.Getenv("METRICS_USERNAME"), os.Getenv("METRICS_PASSWORD")
+	if username == "" && password == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,15 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Funskie/blogIris/api/requests"
+)
+
+// SetMaxBodySize sets the largest body, in bytes, that a route's handler
+// will bind.
+func SetMaxBodySize(n int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(requests.WithMaxBodySize(r.Context(), n)))
+	}
+}
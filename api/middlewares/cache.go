@@ -0,0 +1,20 @@
+package middlewares
+
+import "net/http"
+
+// SetCacheControl sets the Cache-Control policy of a route's responses.
+func SetCacheControl(policy string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", policy)
+		next(w, r)
+	}
+}
+
+// SetMiddlewareNoStore keeps responses for authenticated users out of
+// shared and browser caches.
+func SetMiddlewareNoStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
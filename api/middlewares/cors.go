@@ -0,0 +1,138 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS lets browser pages on other origins call the API. A nil CORS
+// allows no other origin.
+type CORS struct {
+	// AllowedOrigins are exact origins such as https://app.example.com,
+	// or "*" for any origin.
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+}
+
+var (
+	defaultCORSHeaders = []string{
+		"Authorization", "Content-Type", "If-Match", "If-None-Match",
+		RequestIDHeader, APIKeyHeader, "X-CSRF-Token",
+	}
+	defaultCORSExposed = []string{
+		"ETag", "Last-Modified", "Location", "Retry-After", RequestIDHeader, "X-CSRF-Token",
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+	}
+)
+
+// NewCORS reads CORS_ALLOWED_ORIGINS, CORS_ALLOW_CREDENTIALS,
+// CORS_ALLOWED_HEADERS, CORS_EXPOSED_HEADERS and CORS_MAX_AGE. It returns
+// nil when no origin is allowed.
+func NewCORS() (*CORS, error) {
+	origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	c := &CORS{
+		AllowedOrigins:   origins,
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		AllowedHeaders:   defaultCORSHeaders,
+		ExposedHeaders:   defaultCORSExposed,
+		MaxAge:           10 * time.Minute,
+	}
+	if headers := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(headers) > 0 {
+		c.AllowedHeaders = headers
+	}
+	if headers := splitList(os.Getenv("CORS_EXPOSED_HEADERS")); len(headers) > 0 {
+		c.ExposedHeaders = headers
+	}
+	if d, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil {
+		c.MaxAge = d
+	}
+	for _, origin := range origins {
+		// Browsers refuse credentials with a wildcard, and echoing any
+		// origin instead would hand every site the user's session.
+		if origin == "*" && c.AllowCredentials {
+			return nil, errors.New("CORS_ALLOWED_ORIGINS cannot be * with CORS_ALLOW_CREDENTIALS")
+		}
+	}
+	return c, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for the
+// request's origin, if it is allowed.
+func (c *CORS) allowOrigin(r *http.Request) (string, bool) {
+	origin := r.Header.Get("Origin")
+	if c == nil || origin == "" {
+		return "", false
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// Middleware adds the CORS headers to the responses to allowed origins.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin, ok := c.allowOrigin(r); ok {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			if c.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if len(c.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Preflight answers a CORS preflight request for a path supporting the
+// given methods. It reports whether the request was one; the caller
+// writes the response either way.
+func (c *CORS) Preflight(w http.ResponseWriter, r *http.Request, methods []string) bool {
+	requested := r.Header.Get("Access-Control-Request-Method")
+	if requested == "" {
+		return false
+	}
+	if _, ok := c.allowOrigin(r); !ok {
+		return true
+	}
+	for _, method := range methods {
+		if method == requested {
+			h := w.Header()
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			break
+		}
+	}
+	return true
+}
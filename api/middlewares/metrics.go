@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/metrics"
+)
+
+// SetMiddlewareMetrics counts and times requests by route template rather
+// than path, which keeps IDs out of the metric labels.
+func SetMiddlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+
+		next.ServeHTTP(sw, r)
+
+		metrics.ObserveRequest(r.Method, route, sw.Status(), time.Since(start))
+	})
+}
+
+// CountLogins wraps a login handler, counting the attempts that issued a
+// token as successful and all others as failed.
+func CountLogins(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+		metrics.ObserveLogin(method, sw.Status() == http.StatusOK)
+	}
+}
@@ -3,24 +3,43 @@ package middlewares
 import (
 	"net/http"
 
+	jwt "github.com/dgrijalva/jwt-go"
+
 	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/metrics"
+	"github.com/Funskie/blogIris/api/models"
 	"github.com/Funskie/blogIris/api/responses"
 )
 
-func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func SetMiddlewareJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func SetMiddlewareAuthentication(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		err := auth.TokenValid(r)
+func SetMiddlewareAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.ExtractTokenClaims(r)
 		if err != nil {
+			metrics.ObserveTokenFailure(tokenFailureReason(r, err))
 			responses.Error(w, http.StatusUnauthorized, err)
 			return
 		}
-		next(w, r)
+		setUserID(r, claims.UserID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tokenFailureReason(r *http.Request, err error) string {
+	if err == auth.ErrNoCredentials {
+		return "missing"
+	}
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+		return "expired"
+	}
+	if err == models.ErrSessionRevoked {
+		return "revoked"
 	}
+	return "invalid"
 }
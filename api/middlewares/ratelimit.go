@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/metrics"
+	"github.com/Funskie/blogIris/api/ratelimit"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// RateLimiter throttles clients with token bucket policies kept in a
+// shared store. A nil limiter, store or policy lets every request through.
+type RateLimiter struct {
+	Store    ratelimit.Store
+	Policies map[string]*ratelimit.Policy
+	// APIKeys maps the keys of known API clients to their names. Unknown
+	// keys are ignored, so that made up keys cannot dodge the limits.
+	APIKeys map[string]string
+	// TrustProxy takes the client IP from the X-Forwarded-For entry added
+	// by the reverse proxy instead of the connection's address.
+	TrustProxy bool
+}
+
+// DefaultRateLimits are the policies used when their RATE_LIMIT_<NAME>
+// variable is not set. The login and signup ones are strict since they are
+// what password guessing and spam accounts go through.
+var DefaultRateLimits = map[string]string{
+	"default": "300/1m",
+	"login":   "10/1m,burst=5",
+	"signup":  "5/1h",
+	"posts":   "30/1m,burst=10",
+}
+
+// NewRateLimiter configures a limiter from the environment: the policies
+// from RATE_LIMIT_<NAME>, the API clients from RATE_LIMIT_API_KEYS as
+// comma separated name:key pairs and proxy trust from
+// RATE_LIMIT_TRUST_PROXY.
+func NewRateLimiter(store ratelimit.Store) (*RateLimiter, error) {
+	l := &RateLimiter{
+		Store:      store,
+		Policies:   map[string]*ratelimit.Policy{},
+		APIKeys:    map[string]string{},
+		TrustProxy: os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true",
+	}
+	for name, fallback := range DefaultRateLimits {
+		p, err := ratelimit.PolicyFromEnv(name, fallback)
+		if err != nil {
+			return nil, err
+		}
+		l.Policies[name] = p
+	}
+	for _, pair := range strings.Split(os.Getenv("RATE_LIMIT_API_KEYS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("RATE_LIMIT_API_KEYS: expected name:key, got %q", pair)
+		}
+		l.APIKeys[key] = name
+	}
+	return l, nil
+}
+
+// KeyFunc names the client a request is counted against.
+type KeyFunc func(l *RateLimiter, r *http.Request) string
+
+// ByIP counts requests by client IP, for routes used before signing in.
+func ByIP(l *RateLimiter, r *http.Request) string {
+	return "ip:" + l.clientIP(r)
+}
+
+// ByClient counts signed in users by user ID, known API clients by key
+// and everyone else by IP. Tokens are only verified, not looked up, so
+// limiting does not cost a query of the sessions.
+func ByClient(l *RateLimiter, r *http.Request) string {
+	if token := auth.ExtractToken(r); token != "" {
+		if uid, err := auth.TokenSubject(token); err == nil {
+			return "user:" + strconv.FormatUint(uint64(uid), 10)
+		}
+	}
+	if name, ok := l.APIKeys[r.Header.Get(APIKeyHeader)]; ok {
+		return "key:" + name
+	}
+	return ByIP(l, r)
+}
+
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	if l.TrustProxy {
+		// The proxy appends the address it saw, anything before it was
+		// sent by the client.
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware applies the named policy to every request of a router.
+func (l *RateLimiter) Middleware(policy string, key KeyFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return l.Limit(policy, key, next.ServeHTTP)
+	}
+}
+
+// Limit applies the named policy to a single route, on top of the one of
+// the router.
+func (l *RateLimiter) Limit(policy string, key KeyFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l == nil || l.Store == nil || l.Policies[policy] == nil {
+			next(w, r)
+			return
+		}
+		p := l.Policies[policy]
+
+		res, err := l.Store.Take(r.Context(), p.Name+":"+key(l, r), *p)
+		if err != nil {
+			// An unavailable store should not take the API down with it.
+			logger.FromContext(r.Context()).Warn("rate limit store failed", "policy", p.Name, "error", err)
+			next(w, r)
+			return
+		}
+		setRateLimitHeaders(w, *p, res)
+		if !res.Allowed {
+			metrics.ObserveRateLimited(p.Name)
+			retry := ceilSeconds(res.RetryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			responses.Problem(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", retry))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// setRateLimitHeaders sends the RateLimit fields of the IETF draft. When
+// several policies apply, the one closest to its limit is reported.
+func setRateLimitHeaders(w http.ResponseWriter, p ratelimit.Policy, res ratelimit.Result) {
+	h := w.Header()
+	if current, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && current <= res.Remaining {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, ceilSeconds(p.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
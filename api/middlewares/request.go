@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestInfoKey contextKey = 0
+
+// requestInfo is shared by the middlewares of one request. Inner middlewares
+// fill in what the outer ones log once the handler returns.
+type requestInfo struct {
+	ID     string
+	UserID uint32
+	Route  string
+}
+
+func infoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// GetRequestID returns the ID of the request the context belongs to.
+func GetRequestID(ctx context.Context) string {
+	if info := infoFrom(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+func setUserID(r *http.Request, uid uint32) {
+	if info := infoFrom(r.Context()); info != nil {
+		info.UserID = uid
+	}
+}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// SetMiddlewareRequestID propagates the caller's X-Request-ID, or generates
+// one, and echoes it in the response.
+func SetMiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id, _ = auth.RandomString(12)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r.Header.Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestInfoKey, &requestInfo{ID: id})
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func SetMiddlewareLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		info := infoFrom(r.Context())
+		if info == nil {
+			info = &requestInfo{}
+			r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			info.Route, _ = route.GetPathTemplate()
+		}
+
+		next.ServeHTTP(sw, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", info.Route),
+			slog.Int("status", sw.Status()),
+			slog.Int("bytes", sw.bytes),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if info.UserID != 0 {
+			attrs = append(attrs, slog.Any("user_id", info.UserID))
+		}
+		logger.FromContext(r.Context()).LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// SetMiddlewareRecovery turns a panicking handler into a 500 problem
+// response instead of a dropped connection.
+func SetMiddlewareRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logger.FromContext(r.Context()).Error("panic", "method", r.Method, "path", r.URL.Path, "error", err, "stack", string(debug.Stack()))
+				if !sw.wroteHeader {
+					responses.Problem(sw, http.StatusInternalServerError, "The server failed to handle the request")
+				}
+			}
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Chain wraps the handler with the middlewares, the first one outermost.
+func Chain(h http.Handler, mws ...mux.MiddlewareFunc) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
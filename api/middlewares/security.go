@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/responses"
+)
+
+// SecurityHeaders returns a middleware setting the browser security
+// headers. The API only serves JSON, so the default policy forbids loading
+// or framing anything. SECURITY_CSP and SECURITY_REFERRER_POLICY override
+// the defaults and HSTS_MAX_AGE, in seconds, is 0 to not send HSTS.
+func SecurityHeaders() mux.MiddlewareFunc {
+	csp := os.Getenv("SECURITY_CSP")
+	if csp == "" {
+		csp = "default-src 'none'; frame-ancestors 'none'"
+	}
+	referrer := os.Getenv("SECURITY_REFERRER_POLICY")
+	if referrer == "" {
+		referrer = "no-referrer"
+	}
+	hsts := "max-age=31536000; includeSubDomains"
+	if v := os.Getenv("HSTS_MAX_AGE"); v != "" {
+		age, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+		case age <= 0:
+			hsts = ""
+		default:
+			hsts = "max-age=" + strconv.Itoa(age) + "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Content-Security-Policy", csp)
+			h.Set("Referrer-Policy", referrer)
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			// Browsers ignore HSTS over plain HTTP, where it is only
+			// reached through a TLS terminating proxy.
+			if hsts != "" && (r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https") {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetMiddlewareCSRF protects cookie authenticated requests that change
+// state. Their X-CSRF-Token header must repeat the CSRF cookie issued with
+// the session, which other sites can neither read nor set. Bearer tokens
+// are never sent by the browser on its own, so they need no check, but
+// any other Authorization header leaves the cookie to authenticate.
+func SetMiddlewareCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !auth.CookiesEnabled() || auth.BearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Without a valid session the request is anonymous, for example a
+		// login with an expired cookie, and there is nothing to forge.
+		token, err := r.Cookie(auth.TokenCookie)
+		if err != nil || auth.TokenValid(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		csrf, err := r.Cookie(auth.CSRFCookie)
+		header := r.Header.Get(auth.CSRFHeader)
+		if err != nil || header == "" ||
+			subtle.ConstantTimeCompare([]byte(header), []byte(csrf.Value)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(header), []byte(auth.CSRFToken(token.Value))) != 1 {
+			responses.Problem(w, http.StatusForbidden, "Missing or invalid CSRF token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
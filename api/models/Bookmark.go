@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Bookmark saves a post for later. Bookmarks are private to their user.
+type Bookmark struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_bookmarks_user_post" json:"user_id"`
+	PostID    uint64    `gorm:"not null;unique_index:idx_bookmarks_user_post;index" json:"post_id"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// SaveBookmark bookmarks the post unless it already is, and reports
+// whether the bookmark was added.
+func (b *Bookmark) SaveBookmark(db *gorm.DB) (bool, error) {
+	existing := Bookmark{}
+	err := db.Where("user_id = ? AND post_id = ?", b.UserID, b.PostID).Take(&existing).Error
+	if err == nil {
+		*b = existing
+		return false, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+
+	b.CreatedAt = time.Now()
+	err = db.Create(b).Error
+	if err != nil {
+		// A concurrent request may have added it first.
+		if db.Where("user_id = ? AND post_id = ?", b.UserID, b.PostID).Take(&existing).Error == nil {
+			*b = existing
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *Bookmark) DeleteBookmark(db *gorm.DB, uid uint32, pid uint64) (int64, error) {
+	db = db.Where("user_id = ? AND post_id = ?", uid, pid).Delete(&Bookmark{})
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// FindBookmarkedPosts lists the posts the user bookmarked last. Posts in
+// the trash are left out until they are restored.
+func (b *Bookmark) FindBookmarkedPosts(db *gorm.DB, uid uint32) (*[]Post, error) {
+	var posts []Post
+	err := db.Select("posts.*").Joins("JOIN bookmarks ON bookmarks.post_id = posts.id AND bookmarks.user_id = ?", uid).
+		Order("bookmarks.created_at desc, bookmarks.id desc").Limit(100).Find(&posts).Error
+	if err != nil {
+		return &[]Post{}, err
+	}
+	err = LoadPostRelations(db, PostPointers(posts)...)
+	if err != nil {
+		return &[]Post{}, err
+	}
+	bookmarked := true
+	for i := range posts {
+		posts[i].Bookmarked = &bookmarked
+	}
+	return &posts, nil
+}
+
+// LoadBookmarked marks which of the posts the user bookmarked, in a single
+// query.
+func LoadBookmarked(db *gorm.DB, uid uint32, posts ...*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	var bookmarked []uint64
+	err := db.Model(&Bookmark{}).Where("user_id = ? AND post_id IN (?)", uid, ids).Pluck("post_id", &bookmarked).Error
+	if err != nil {
+		return err
+	}
+	set := make(map[uint64]bool, len(bookmarked))
+	for _, id := range bookmarked {
+		set[id] = true
+	}
+	for _, p := range posts {
+		flag := set[p.ID]
+		p.Bookmarked = &flag
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrFollowSelf = errors.New("Cannot Follow Yourself")
+
+// Follow records that one user follows another, whose posts then show up
+// in the follower's timeline.
+type Follow struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	FollowerID uint32    `gorm:"not null;unique_index:idx_follows_follower_followed" json:"follower_id"`
+	FollowedID uint32    `gorm:"not null;unique_index:idx_follows_follower_followed;index" json:"followed_id"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// FollowCounts are the sizes of a user's follow lists.
+type FollowCounts struct {
+	UserID    uint32 `json:"user_id"`
+	Followers int    `json:"followers"`
+	Following int    `json:"following"`
+}
+
+// SaveFollow follows the user unless already following, and reports
+// whether the follow was added.
+func (f *Follow) SaveFollow(db *gorm.DB) (bool, error) {
+	if f.FollowerID == f.FollowedID {
+		return false, ErrFollowSelf
+	}
+	existing := Follow{}
+	err := db.Where("follower_id = ? AND followed_id = ?", f.FollowerID, f.FollowedID).Take(&existing).Error
+	if err == nil {
+		*f = existing
+		return false, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+
+	f.CreatedAt = time.Now()
+	err = db.Create(f).Error
+	if err != nil {
+		// A concurrent request may have added it first.
+		if db.Where("follower_id = ? AND followed_id = ?", f.FollowerID, f.FollowedID).Take(&existing).Error == nil {
+			*f = existing
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *Follow) DeleteFollow(db *gorm.DB, followerID, followedID uint32) (int64, error) {
+	db = db.Where("follower_id = ? AND followed_id = ?", followerID, followedID).Delete(&Follow{})
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// activeFollows selects the follows between users who are not in the
+// trash. The user on the other side of the list is joined as u.
+func activeFollows(db *gorm.DB, other string) *gorm.DB {
+	return db.Table("follows").
+		Joins("JOIN users u ON u.id = follows." + other + " AND u.deleted_at IS NULL")
+}
+
+// CountFollows counts the followers and followed users of the user, leaving
+// out those in the trash.
+func CountFollows(db *gorm.DB, uid uint32) (FollowCounts, error) {
+	counts := FollowCounts{UserID: uid}
+	err := activeFollows(db, "follower_id").Where("follows.followed_id = ?", uid).Count(&counts.Followers).Error
+	if err != nil {
+		return FollowCounts{}, err
+	}
+	err = activeFollows(db, "followed_id").Where("follows.follower_id = ?", uid).Count(&counts.Following).Error
+	if err != nil {
+		return FollowCounts{}, err
+	}
+	return counts, nil
+}
+
+// FindFollowers lists the latest followers of the user.
+func (f *Follow) FindFollowers(db *gorm.DB, uid uint32) (*[]User, error) {
+	return findFollowUsers(activeFollows(db, "follower_id").Where("follows.followed_id = ?", uid))
+}
+
+// FindFollowing lists the users the user followed last.
+func (f *Follow) FindFollowing(db *gorm.DB, uid uint32) (*[]User, error) {
+	return findFollowUsers(activeFollows(db, "followed_id").Where("follows.follower_id = ?", uid))
+}
+
+func findFollowUsers(query *gorm.DB) (*[]User, error) {
+	var users []User
+	err := query.Select("u.*").Order("follows.created_at desc, follows.id desc").Limit(100).Scan(&users).Error
+	if err != nil {
+		return &[]User{}, err
+	}
+	return &users, nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Identity links a user to an account at an external identity provider.
+type Identity struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	Provider  string    `gorm:"size:100;not null;unique_index:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;unique_index:idx_identity_provider_subject" json:"subject"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (i *Identity) SaveIdentity(db *gorm.DB) (*Identity, error) {
+	err := db.Create(i).Error
+	if err != nil {
+		return &Identity{}, err
+	}
+	return i, nil
+}
+
+func (i *Identity) FindIdentity(db *gorm.DB, provider, subject string) (*Identity, error) {
+	err := db.Where("provider = ? AND subject = ?", provider, subject).Take(i).Error
+	if err != nil {
+		return &Identity{}, err
+	}
+	return i, nil
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// maxMentions is how many users a post can mention, more are left as
+// plain text.
+const maxMentions = 20
+
+// mentionPattern matches @nickname, unless the @ follows a word as in an
+// email address. Nicknames with other characters, such as spaces, cannot
+// be mentioned.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@/])@([\p{L}\p{N}_](?:[\p{L}\p{N}_.-]*[\p{L}\p{N}_])?)`)
+
+// ProfileURL is the link of mentions, where {id} is replaced by the ID of
+// the user, see LoadProfileURL.
+var ProfileURL = "/users/{id}"
+
+// LoadProfileURL configures the link of mentions from PROFILE_URL, such as
+// "https://app.example.com/profiles/{id}". The default is the user route
+// of the API.
+func LoadProfileURL() error {
+	url := strings.TrimSpace(os.Getenv("PROFILE_URL"))
+	if url == "" {
+		ProfileURL = "/users/{id}"
+		return nil
+	}
+	if !strings.Contains(url, "{id}") || strings.ContainsAny(url, `"<> `) {
+		return fmt.Errorf("invalid PROFILE_URL: %q", url)
+	}
+	ProfileURL = url
+	return nil
+}
+
+// Mention links a @nickname in a post to the user it referred to when the
+// post was saved. Name is the nickname the user had then, so links survive
+// them renaming themselves.
+type Mention struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	PostID    uint64    `gorm:"not null;unique_index:idx_mentions_post_user" json:"post_id"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_mentions_post_user;index" json:"user_id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// ParseMentions returns the nicknames mentioned in the content, each once
+// whatever its case, in the order they first appear.
+func ParseMentions(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		key := strings.ToLower(m[1])
+		if !seen[key] && len(names) < maxMentions {
+			seen[key] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// SaveMentions records the users mentioned in the post, replacing those of
+// its previous content, and returns those it did not mention before.
+// Nicknames the post already mentioned keep referring to the same user,
+// even if they renamed themselves and someone else took the nickname.
+// Nicknames of no user, or of users in the trash, stay plain text.
+func SaveMentions(db *gorm.DB, p *Post) ([]uint32, error) {
+	var existing []Mention
+	err := db.Where("post_id = ?", p.ID).Find(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Mention, len(existing))
+	byUser := make(map[uint32]*Mention, len(existing))
+	for i := range existing {
+		byName[strings.ToLower(existing[i].Name)] = &existing[i]
+		byUser[existing[i].UserID] = &existing[i]
+	}
+
+	// Nicknames mentioned before keep their user, the others are looked
+	// up.
+	kept := map[uint64]bool{}
+	mentioned := map[uint32]bool{}
+	var lookup []string
+	for _, name := range ParseMentions(p.Content) {
+		key := strings.ToLower(name)
+		if m, ok := byName[key]; ok {
+			kept[m.ID] = true
+			mentioned[m.UserID] = true
+		} else {
+			lookup = append(lookup, key)
+		}
+	}
+	var users []User
+	if len(lookup) > 0 {
+		err = db.Where("LOWER(nickname) IN (?)", lookup).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var added []uint32
+	for _, u := range users {
+		if mentioned[u.ID] {
+			continue
+		}
+		mentioned[u.ID] = true
+		// A user mentioned before under their old nickname keeps their
+		// mention, renamed.
+		if m, ok := byUser[u.ID]; ok && !kept[m.ID] {
+			kept[m.ID] = true
+			err = db.Model(&Mention{}).Where("id = ?", m.ID).UpdateColumn("name", u.Nickname).Error
+		} else {
+			added = append(added, u.ID)
+			err = db.Create(&Mention{PostID: p.ID, UserID: u.ID, Name: u.Nickname, CreatedAt: time.Now()}).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var removed []uint64
+	for _, m := range existing {
+		if !kept[m.ID] {
+			removed = append(removed, m.ID)
+		}
+	}
+	if len(removed) > 0 {
+		err = db.Where("id IN (?)", removed).Delete(&Mention{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// LoadMentions renders the content of the posts as HTML with their
+// mentions linked, in a single query. Mentions of users in the trash are
+// left as plain text.
+func LoadMentions(db *gorm.DB, posts []*Post) error {
+	var ids []uint64
+	for _, p := range posts {
+		p.ContentHTML = p.Content
+		if strings.Contains(p.Content, "@") {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var mentions []Mention
+	err := db.Table("mentions").Select("mentions.*").
+		Joins("JOIN users ON users.id = mentions.user_id AND users.deleted_at IS NULL").
+		Where("mentions.post_id IN (?)", ids).
+		Scan(&mentions).Error
+	if err != nil {
+		return err
+	}
+	byPost := map[uint64]map[string]uint32{}
+	for _, m := range mentions {
+		if byPost[m.PostID] == nil {
+			byPost[m.PostID] = map[string]uint32{}
+		}
+		byPost[m.PostID][strings.ToLower(m.Name)] = m.UserID
+	}
+	for _, p := range posts {
+		if links := byPost[p.ID]; links != nil {
+			p.ContentHTML = renderMentions(p.Content, links)
+		}
+	}
+	return nil
+}
+
+// renderMentions links the mentions of the content, which is stored HTML
+// escaped. Nicknames are written as in the content, which only holds safe
+// characters where it matched.
+func renderMentions(content string, links map[string]uint32) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		name := content[m[2]:m[3]]
+		uid, ok := links[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		at := m[2] - 1
+		url := strings.ReplaceAll(ProfileURL, "{id}", strconv.FormatUint(uint64(uid), 10))
+		b.WriteString(content[last:at])
+		fmt.Fprintf(&b, `<a href="%s" class="mention" data-user-id="%d">@%s</a>`, url, uid, name)
+		last = m[3]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
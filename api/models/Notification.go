@@ -0,0 +1,276 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The events users are notified of. Posts have no comments yet, so nothing
+// notifies of comments and replies; their types exist so that users can
+// already choose whether they want them, and so that clients know them.
+const (
+	NotificationFollow   = "follow"
+	NotificationReaction = "reaction"
+	NotificationMention  = "mention"
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+)
+
+// NotificationTypes lists every type of notification, each of which users
+// can turn off.
+var NotificationTypes = []string{NotificationFollow, NotificationReaction, NotificationMention, NotificationComment, NotificationReply}
+
+var ErrUnknownNotification = errors.New("Unknown Notification Type")
+
+// IsNotificationType reports whether typ is one of NotificationTypes.
+func IsNotificationType(typ string) bool {
+	for _, t := range NotificationTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification tells a user that another one, the actor, did something
+// concerning them: followed them, reacted to or commented on their post,
+// replied to their comment or mentioned them in a post. Detail is the kind
+// of a reaction.
+type Notification struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index:idx_notifications_user_read" json:"-"`
+	Type      string     `gorm:"size:32;not null" json:"type"`
+	ActorID   uint32     `gorm:"not null;index" json:"actor_id"`
+	Actor     User       `gorm:"-" json:"actor"`
+	PostID    *uint64    `gorm:"index" json:"post_id,omitempty"`
+	Detail    string     `gorm:"size:32;not null" json:"detail,omitempty"`
+	ReadAt    *time.Time `gorm:"index:idx_notifications_user_read" json:"read_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// NotificationPreference turns a type of notification on or off for a
+// user. Types without a preference are on.
+type NotificationPreference struct {
+	ID      uint64 `gorm:"primary_key;auto_increment" json:"-"`
+	UserID  uint32 `gorm:"not null;unique_index:idx_notification_preferences_user_type" json:"-"`
+	Type    string `gorm:"size:32;not null;unique_index:idx_notification_preferences_user_type" json:"type"`
+	Enabled bool   `gorm:"not null" json:"enabled"`
+}
+
+// SaveNotification records the notification in its user's inbox and
+// reports whether it was added. Users are not notified of their own
+// actions, of types they turned off, nor twice of the same unread event.
+func (n *Notification) SaveNotification(db *gorm.DB) (bool, error) {
+	if !IsNotificationType(n.Type) {
+		return false, ErrUnknownNotification
+	}
+	if n.UserID == n.ActorID {
+		return false, nil
+	}
+	prefs, err := FindNotificationPreferences(db, n.UserID)
+	if err != nil {
+		return false, err
+	}
+	if !prefs[n.Type] {
+		return false, nil
+	}
+
+	query := db.Model(&Notification{}).Where("user_id = ? AND type = ? AND actor_id = ? AND detail = ? AND read_at IS NULL", n.UserID, n.Type, n.ActorID, n.Detail)
+	if n.PostID != nil {
+		query = query.Where("post_id = ?", *n.PostID)
+	} else {
+		query = query.Where("post_id IS NULL")
+	}
+	count := 0
+	err = query.Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	n.ReadAt = nil
+	n.CreatedAt = time.Now()
+	err = db.Create(n).Error
+	if err != nil {
+		return false, err
+	}
+	return true, LoadNotificationActors(db, []*Notification{n})
+}
+
+// activeNotifications selects the notifications of the user, leaving out
+// those of actors and about posts in the trash.
+func activeNotifications(db *gorm.DB, uid uint32) *gorm.DB {
+	return db.Table("notifications").Select("notifications.*").
+		Joins("JOIN users ON users.id = notifications.actor_id AND users.deleted_at IS NULL").
+		Where("notifications.user_id = ?", uid).
+		Where("notifications.post_id IS NULL OR notifications.post_id IN (?)", db.Model(&Post{}).Select("id").QueryExpr())
+}
+
+// FindNotifications lists the latest notifications of the user older than
+// the before ID, unless it is 0, with their actors. It fetches one more
+// than limit, which tells callers whether there is another page.
+func FindNotifications(db *gorm.DB, uid uint32, unreadOnly bool, before uint64, limit int) (*[]Notification, error) {
+	query := activeNotifications(db, uid)
+	if unreadOnly {
+		query = query.Where("notifications.read_at IS NULL")
+	}
+	if before != 0 {
+		query = query.Where("notifications.id < ?", before)
+	}
+	return findNotifications(db, query.Order("notifications.id desc").Limit(limit+1))
+}
+
+// FindNotificationsAfter lists the notifications of the user newer than
+// the after ID in the order they were made, for streams catching up.
+func FindNotificationsAfter(db *gorm.DB, uid uint32, after uint64) (*[]Notification, error) {
+	query := activeNotifications(db, uid).Where("notifications.id > ?", after)
+	return findNotifications(db, query.Order("notifications.id").Limit(100))
+}
+
+// LatestNotificationID is the ID of the user's latest notification, 0 when
+// they have none.
+func LatestNotificationID(db *gorm.DB, uid uint32) (uint64, error) {
+	var ids []uint64
+	err := db.Model(&Notification{}).Where("user_id = ?", uid).Order("id desc").Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+func findNotifications(db, query *gorm.DB) (*[]Notification, error) {
+	var notifications []Notification
+	err := query.Find(&notifications).Error
+	if err != nil {
+		return &[]Notification{}, err
+	}
+	ptrs := make([]*Notification, len(notifications))
+	for i := range notifications {
+		ptrs[i] = &notifications[i]
+	}
+	err = LoadNotificationActors(db, ptrs)
+	if err != nil {
+		return &[]Notification{}, err
+	}
+	return &notifications, nil
+}
+
+// LoadNotificationActors fetches the actors of the notifications in a
+// single query.
+func LoadNotificationActors(db *gorm.DB, notifications []*Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	ids := make([]uint32, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ActorID
+	}
+	var users []User
+	err := db.Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint32]User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	for _, n := range notifications {
+		n.Actor = byID[n.ActorID]
+	}
+	return nil
+}
+
+// CountUnreadNotifications counts the notifications the user has not read.
+func CountUnreadNotifications(db *gorm.DB, uid uint32) (int, error) {
+	count := 0
+	err := activeNotifications(db, uid).Where("notifications.read_at IS NULL").Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks the user's notification as read. Reading it again
+// changes nothing.
+func (n *Notification) MarkRead(db *gorm.DB, uid uint32, id uint64) (*Notification, error) {
+	err := db.Where("id = ? AND user_id = ?", id, uid).Take(n).Error
+	if err != nil {
+		return &Notification{}, err
+	}
+	if n.ReadAt != nil {
+		return n, nil
+	}
+	now := time.Now()
+	err = db.Model(&Notification{}).Where("id = ?", id).UpdateColumn("read_at", now).Error
+	if err != nil {
+		return &Notification{}, err
+	}
+	n.ReadAt = &now
+	return n, nil
+}
+
+// MarkAllNotificationsRead marks the notifications of the user as read,
+// only up to the until ID unless it is 0, so that clients do not mark
+// those they have not shown yet.
+func MarkAllNotificationsRead(db *gorm.DB, uid uint32, until uint64) (int64, error) {
+	query := db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", uid)
+	if until != 0 {
+		query = query.Where("id <= ?", until)
+	}
+	result := query.UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// FindNotificationPreferences tells which types of notification the user
+// gets, with every type present.
+func FindNotificationPreferences(db *gorm.DB, uid uint32) (map[string]bool, error) {
+	var prefs []NotificationPreference
+	err := db.Where("user_id = ?", uid).Find(&prefs).Error
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		enabled[t] = true
+	}
+	for _, p := range prefs {
+		if _, ok := enabled[p.Type]; ok {
+			enabled[p.Type] = p.Enabled
+		}
+	}
+	return enabled, nil
+}
+
+// SaveNotificationPreferences turns the given types of notification on or
+// off for the user, leaving the others as they are.
+func SaveNotificationPreferences(db *gorm.DB, uid uint32, changes map[string]bool) error {
+	for typ := range changes {
+		if !IsNotificationType(typ) {
+			return ErrUnknownNotification
+		}
+	}
+	tx := db.Begin()
+	for typ, enabled := range changes {
+		result := tx.Model(&NotificationPreference{}).Where("user_id = ? AND type = ?", uid, typ).UpdateColumn("enabled", enabled)
+		if result.Error != nil {
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+		// Nothing changed, either because the preference is missing or
+		// because it already has the value.
+		existing := 0
+		err := tx.Model(&NotificationPreference{}).Where("user_id = ? AND type = ?", uid, typ).Count(&existing).Error
+		if err == nil && existing == 0 {
+			err = tx.Create(&NotificationPreference{UserID: uid, Type: typ, Enabled: enabled}).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrTokenNotFound = errors.New("Token not found")
+	ErrTokenExpired  = errors.New("Token expired")
+	ErrTokenConsumed = errors.New("Token already used")
+)
+
+// OneTimeToken stores short-lived single-use secrets such as OIDC login
+// state and magic links. Only the SHA-256 of the secret is kept in the database.
+type OneTimeToken struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	Purpose    string     `gorm:"size:50;not null;index" json:"purpose"`
+	TokenHash  string     `gorm:"size:64;not null;unique" json:"-"`
+	Subject    string     `gorm:"size:255;index" json:"subject"`
+	Data       string     `gorm:"type:text" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueOneTimeToken stores a new token and returns the raw secret, which is
+// never persisted.
+func IssueOneTimeToken(db *gorm.DB, purpose, subject, data string, ttl time.Duration) (string, *OneTimeToken, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", &OneTimeToken{}, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	t := &OneTimeToken{
+		Purpose:   purpose,
+		TokenHash: HashToken(raw),
+		Subject:   subject,
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+	err = db.Create(t).Error
+	if err != nil {
+		return "", &OneTimeToken{}, err
+	}
+	return raw, t, nil
+}
+
+// ConsumeOneTimeToken marks the token as used and returns it. A token can be
+// consumed only once, even by concurrent requests.
+func ConsumeOneTimeToken(db *gorm.DB, purpose, raw string) (*OneTimeToken, error) {
+	t := &OneTimeToken{}
+	err := db.Where("purpose = ? AND token_hash = ?", purpose, HashToken(raw)).Take(t).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &OneTimeToken{}, ErrTokenNotFound
+		}
+		return &OneTimeToken{}, err
+	}
+	if t.ConsumedAt != nil {
+		return t, ErrTokenConsumed
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return t, ErrTokenExpired
+	}
+
+	now := time.Now()
+	db = db.Model(&OneTimeToken{}).Where("id = ? AND consumed_at IS NULL", t.ID).UpdateColumn("consumed_at", now)
+	if db.Error != nil {
+		return &OneTimeToken{}, db.Error
+	}
+	if db.RowsAffected != 1 {
+		return t, ErrTokenConsumed
+	}
+	t.ConsumedAt = &now
+	return t, nil
+}
+
+// CountOneTimeTokens counts the tokens issued for a subject since the given
+// time, used to limit how often secrets can be requested.
+func CountOneTimeTokens(db *gorm.DB, purpose, subject string, since time.Time) (int, error) {
+	var count int
+	err := db.Model(&OneTimeToken{}).Where("purpose = ? AND subject = ? AND created_at > ?", purpose, subject, since).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
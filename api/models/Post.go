@@ -9,14 +9,28 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+// ErrVersionConflict is returned by compare-and-swap updates of records
+// that changed since they were read.
+var ErrVersionConflict = errors.New("Version Conflict")
+
+// Post is a blog post. ContentHTML is its content with the mentions linked,
+// see LoadMentions, and Mentioned are the users its last save mentioned
+// for the first time, for callers to notify.
 type Post struct {
-	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
-	Title     string    `gorm:"size:255;not null;unique" json:"title"`
-	Content   string    `gorm:"text;not null;" json:"content"`
-	Author    User      `gorm:"foreignkey:AuthorID" json:"author"`
-	AuthorID  uint32    `gorm:"not null" json:"author_id"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID          uint64         `gorm:"primary_key;auto_increment" json:"id"`
+	Title       string         `gorm:"size:255;not null;unique" json:"title"`
+	Content     string         `gorm:"text;not null;" json:"content,omitempty"`
+	ContentHTML string         `gorm:"-" json:"content_html,omitempty"`
+	Mentioned   []uint32       `gorm:"-" json:"-"`
+	Author      User           `gorm:"foreignkey:AuthorID" json:"author"`
+	AuthorID    uint32         `gorm:"not null;index:idx_posts_author_created" json:"author_id"`
+	Version     uint32         `gorm:"not null;default:1" json:"version"`
+	Reactions   map[string]int `gorm:"-" json:"reactions"`
+	ReactedAt   *time.Time     `json:"-"`
+	Bookmarked  *bool          `gorm:"-" json:"bookmarked,omitempty"`
+	CreatedAt   time.Time      `gorm:"default:CURRENT_TIMESTAMP;index:idx_posts_author_created" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt   *time.Time     `sql:"index" json:"deleted_at,omitempty"`
 }
 
 func (p *Post) Prepare() {
@@ -42,12 +56,16 @@ func (p *Post) Validate() error {
 }
 
 func (p *Post) SavePost(db *gorm.DB) (*Post, error) {
-	err := db.Debug().Create(p).Error
+	err := db.Create(p).Error
 	if err != nil {
 		return &Post{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
+		p.Mentioned, err = SaveMentions(db, p)
+		if err != nil {
+			return &Post{}, err
+		}
+		err = LoadPostRelations(db, p)
 		if err != nil {
 			return &Post{}, err
 		}
@@ -56,29 +74,31 @@ func (p *Post) SavePost(db *gorm.DB) (*Post, error) {
 }
 
 func (p *Post) FindAllPosts(db *gorm.DB) (*[]Post, error) {
+	return p.FindPosts(db, nil)
+}
+
+// FindPosts lists the latest posts with only the given columns, see
+// ParsePostFields.
+func (p *Post) FindPosts(db *gorm.DB, fields []string) (*[]Post, error) {
 	var posts []Post
-	err := db.Debug().Limit(100).Find(&posts).Error
+	err := selectFields(db, "posts", fields).Order("id desc").Limit(100).Find(&posts).Error
 	if err != nil {
 		return &[]Post{}, err
 	}
-	if len(posts) > 0 {
-		for i := range posts {
-			err := db.Debug().Model(&User{}).Where("id = ?", posts[i].AuthorID).Take(&posts[i].Author).Error
-			if err != nil {
-				return &[]Post{}, err
-			}
-		}
+	err = LoadPostRelations(db, PostPointers(posts)...)
+	if err != nil {
+		return &[]Post{}, err
 	}
 	return &posts, nil
 }
 
 func (p *Post) FindPostByID(db *gorm.DB, pid uint64) (*Post, error) {
-	err := db.Debug().First(p, pid).Error
+	err := db.First(p, pid).Error
 	if err != nil {
 		return &Post{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
+		err = LoadPostRelations(db, p)
 		if err != nil {
 			return &Post{}, err
 		}
@@ -86,28 +106,41 @@ func (p *Post) FindPostByID(db *gorm.DB, pid uint64) (*Post, error) {
 	return p, nil
 }
 
+// UpdateAPost saves the title and content if the post is still at the
+// version the changes were based on, updates its mentions and reloads it.
+// ErrVersionConflict means someone else saved the post in between.
 func (p *Post) UpdateAPost(db *gorm.DB, pid uint64) (*Post, error) {
-	err := db.Debug().Model(p).Where("id = ?", pid).Updates(
+	result := db.Model(&Post{}).Where("id = ? AND version = ?", pid, p.Version).UpdateColumns(
 		map[string]interface{}{
 			"title":      p.Title,
 			"content":    p.Content,
+			"version":    gorm.Expr("version + 1"),
 			"updated_at": time.Now(),
 		},
-	).Error
+	)
+	if result.Error != nil {
+		return &Post{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &Post{}, ErrVersionConflict
+	}
+	p.ID = pid
+	mentioned, err := SaveMentions(db, p)
 	if err != nil {
 		return &Post{}, err
 	}
-	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
-		if err != nil {
-			return &Post{}, err
-		}
+	_, err = p.FindPostByID(db, pid)
+	if err != nil {
+		return &Post{}, err
 	}
+	p.Mentioned = mentioned
 	return p, nil
 }
 
+// DeleteAPost moves the post to the trash, see RestorePost and
+// PurgeDeleted.
 func (p *Post) DeleteAPost(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
-	db = db.Debug().Where("id = ? and author_id = ?", pid, uid).Delete(p)
+	db = db.Where("id = ? and author_id = ?", pid, uid).Delete(p)
 	if db.Error != nil {
 		if gorm.IsRecordNotFoundError(db.Error) {
 			return 0, errors.New("Post not found")
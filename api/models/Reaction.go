@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrUnknownReaction = errors.New("Unknown Reaction Kind")
+
+// ReactionKind is one of the reactions readers can leave on a post, named
+// in the URLs and shown as its emoji.
+type ReactionKind struct {
+	Name  string `json:"name"`
+	Emoji string `json:"emoji"`
+}
+
+// ReactionKinds is the configured set of reactions, see LoadReactionKinds.
+var ReactionKinds = DefaultReactionKinds
+
+var DefaultReactionKinds = []ReactionKind{
+	{Name: "like", Emoji: "👍"},
+	{Name: "love", Emoji: "❤️"},
+	{Name: "laugh", Emoji: "😂"},
+	{Name: "wow", Emoji: "😮"},
+	{Name: "sad", Emoji: "😢"},
+	{Name: "celebrate", Emoji: "🎉"},
+}
+
+// LoadReactionKinds configures the reactions from REACTION_KINDS, a comma
+// separated list of name:emoji pairs such as "like:👍,love:❤️". Removing a
+// kind hides its stored reactions rather than deleting them.
+func LoadReactionKinds() error {
+	spec := strings.TrimSpace(os.Getenv("REACTION_KINDS"))
+	if spec == "" {
+		ReactionKinds = DefaultReactionKinds
+		return nil
+	}
+	var kinds []ReactionKind
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(spec, ",") {
+		name, emoji, _ := strings.Cut(strings.TrimSpace(pair), ":")
+		name, emoji = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(emoji)
+		if name == "" || emoji == "" || len(name) > 32 || strings.ContainsAny(name, "/?#% ") || seen[name] {
+			return fmt.Errorf("invalid REACTION_KINDS: %q", pair)
+		}
+		seen[name] = true
+		kinds = append(kinds, ReactionKind{Name: name, Emoji: emoji})
+	}
+	ReactionKinds = kinds
+	return nil
+}
+
+// IsReactionKind reports whether kind is one of the configured reactions.
+func IsReactionKind(kind string) bool {
+	for _, k := range ReactionKinds {
+		if k.Name == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func reactionKindNames() []string {
+	names := make([]string, len(ReactionKinds))
+	for i, k := range ReactionKinds {
+		names[i] = k.Name
+	}
+	return names
+}
+
+// Reaction is a user's reaction of one kind to a post. Each user reacts
+// at most once per kind to a post.
+type Reaction struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	PostID    uint64    `gorm:"not null;unique_index:idx_reactions_post_user_kind" json:"post_id"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_reactions_post_user_kind;index" json:"user_id"`
+	Kind      string    `gorm:"size:32;not null;unique_index:idx_reactions_post_user_kind" json:"kind"`
+	User      User      `gorm:"-" json:"user"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (r *Reaction) findReaction(db *gorm.DB) error {
+	return db.Where("post_id = ? AND user_id = ? AND kind = ?", r.PostID, r.UserID, r.Kind).Take(r).Error
+}
+
+// SaveReaction adds the reaction unless the user already left it, and
+// reports whether it was added.
+func (r *Reaction) SaveReaction(db *gorm.DB) (bool, error) {
+	if !IsReactionKind(r.Kind) {
+		return false, ErrUnknownReaction
+	}
+	err := r.findReaction(db)
+	if err == nil {
+		return false, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+
+	r.CreatedAt = time.Now()
+	err = db.Create(r).Error
+	if err != nil {
+		// A concurrent request of the same user may have added it first.
+		if r.findReaction(db) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, touchReactions(db, r.PostID)
+}
+
+// DeleteReaction removes the user's reaction of the kind from the post.
+func (r *Reaction) DeleteReaction(db *gorm.DB, pid uint64, uid uint32, kind string) (int64, error) {
+	result := db.Where("post_id = ? AND user_id = ? AND kind = ?", pid, uid, kind).Delete(&Reaction{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return result.RowsAffected, touchReactions(db, pid)
+	}
+	return 0, nil
+}
+
+// touchReactions records when the reactions of the post last changed,
+// which is part of its Last-Modified time.
+func touchReactions(db *gorm.DB, pid uint64) error {
+	return db.Model(&Post{}).Where("id = ?", pid).UpdateColumn("reacted_at", time.Now()).Error
+}
+
+// FindPostReactions lists the latest reactions to the post with the users
+// who left them, optionally only those of one kind. Reactions of users in
+// the trash are left out.
+func (r *Reaction) FindPostReactions(db *gorm.DB, pid uint64, kind string) (*[]Reaction, error) {
+	query := activeReactions(db).Where("reactions.post_id = ? AND reactions.kind IN (?)", pid, reactionKindNames())
+	if kind != "" {
+		query = query.Where("reactions.kind = ?", kind)
+	}
+	var reactions []Reaction
+	err := query.Order("reactions.created_at desc, reactions.id desc").Limit(100).Find(&reactions).Error
+	if err != nil {
+		return &[]Reaction{}, err
+	}
+	if len(reactions) == 0 {
+		return &reactions, nil
+	}
+
+	ids := make([]uint32, len(reactions))
+	for i, reaction := range reactions {
+		ids[i] = reaction.UserID
+	}
+	var users []User
+	err = db.Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return &[]Reaction{}, err
+	}
+	byID := make(map[uint32]User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	for i := range reactions {
+		reactions[i].User = byID[reactions[i].UserID]
+	}
+	return &reactions, nil
+}
+
+// activeReactions selects the reactions of users who are not in the trash.
+func activeReactions(db *gorm.DB) *gorm.DB {
+	return db.Table("reactions").Select("reactions.*").
+		Joins("JOIN users ON users.id = reactions.user_id AND users.deleted_at IS NULL")
+}
+
+// LoadReactionCounts counts the reactions to the posts by kind in a single
+// query. Every configured kind is present, so clients see the zeros too.
+func LoadReactionCounts(db *gorm.DB, posts []*Post) error {
+	ids := make([]uint64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+		p.Reactions = make(map[string]int, len(ReactionKinds))
+		for _, k := range ReactionKinds {
+			p.Reactions[k.Name] = 0
+		}
+	}
+
+	var counts []struct {
+		PostID uint64
+		Kind   string
+		Count  int
+	}
+	err := activeReactions(db).
+		Select("reactions.post_id, reactions.kind, COUNT(*) AS count").
+		Where("reactions.post_id IN (?) AND reactions.kind IN (?)", ids, reactionKindNames()).
+		Group("reactions.post_id, reactions.kind").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint64]*Post, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+	for _, c := range counts {
+		if p, ok := byID[c.PostID]; ok {
+			p.Reactions[c.Kind] = c.Count
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrReadingListOrder = errors.New("The Order Must Name Every Post Of The List Once")
+
+// ReadingList is a named, ordered list of posts. Private lists are only
+// seen by their owner, public ones by everyone.
+type ReadingList struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32    `gorm:"not null;index" json:"user_id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Public    bool      `gorm:"not null;default:false" json:"public"`
+	Posts     []Post    `gorm:"-" json:"posts,omitempty"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// ReadingListItem places a post in a list. Positions count from 0 and
+// have no gaps.
+type ReadingListItem struct {
+	ID            uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	ReadingListID uint64    `gorm:"not null;unique_index:idx_reading_list_items_list_post" json:"reading_list_id"`
+	PostID        uint64    `gorm:"not null;unique_index:idx_reading_list_items_list_post;index" json:"post_id"`
+	Position      int       `gorm:"not null" json:"position"`
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (l *ReadingList) SaveReadingList(db *gorm.DB) (*ReadingList, error) {
+	l.CreatedAt = time.Now()
+	l.UpdatedAt = l.CreatedAt
+	err := db.Create(l).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l, nil
+}
+
+// FindUserReadingLists lists the user's lists by name, only the public ones
+// unless all is set. The posts are not loaded.
+func (l *ReadingList) FindUserReadingLists(db *gorm.DB, uid uint32, all bool) (*[]ReadingList, error) {
+	query := db.Where("user_id = ?", uid)
+	if !all {
+		query = query.Where("public = ?", true)
+	}
+	var lists []ReadingList
+	err := query.Order("name, id").Limit(100).Find(&lists).Error
+	if err != nil {
+		return &[]ReadingList{}, err
+	}
+	return &lists, nil
+}
+
+// FindReadingListByID finds the list with its posts in order. Posts in the
+// trash are skipped but keep their place for when they are restored.
+func (l *ReadingList) FindReadingListByID(db *gorm.DB, id uint64) (*ReadingList, error) {
+	err := db.First(l, id).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+
+	var ids []uint64
+	err = db.Model(&ReadingListItem{}).Where("reading_list_id = ?", id).Order("position").Pluck("post_id", &ids).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	l.Posts = []Post{}
+	if len(ids) == 0 {
+		return l, nil
+	}
+	var posts []Post
+	err = db.Where("id IN (?)", ids).Find(&posts).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	err = LoadPostRelations(db, PostPointers(posts)...)
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	byID := make(map[uint64]Post, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+	for _, pid := range ids {
+		if p, ok := byID[pid]; ok {
+			l.Posts = append(l.Posts, p)
+		}
+	}
+	return l, nil
+}
+
+// UpdateReadingList saves the name and visibility of the list.
+func (l *ReadingList) UpdateReadingList(db *gorm.DB) (*ReadingList, error) {
+	l.UpdatedAt = time.Now()
+	err := db.Model(&ReadingList{}).Where("id = ?", l.ID).UpdateColumns(
+		map[string]interface{}{
+			"name":       l.Name,
+			"public":     l.Public,
+			"updated_at": l.UpdatedAt,
+		},
+	).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l, nil
+}
+
+// DeleteReadingList removes the user's list and its items.
+func (l *ReadingList) DeleteReadingList(db *gorm.DB, id uint64, uid uint32) (int64, error) {
+	tx := db.Begin()
+	result := tx.Where("id = ? AND user_id = ?", id, uid).Delete(&ReadingList{})
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+	err := tx.Where("reading_list_id = ?", id).Delete(&ReadingListItem{}).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return result.RowsAffected, tx.Commit().Error
+}
+
+// AddPost puts the post in the list at the position, moving the later posts
+// down, or at the end when the position is negative or past it. It reports
+// whether the post was added, it is left in place if already listed.
+func (l *ReadingList) AddPost(db *gorm.DB, pid uint64, position int) (bool, error) {
+	tx := db.Begin()
+	var count int
+	err := tx.Model(&ReadingListItem{}).Where("reading_list_id = ?", l.ID).Count(&count).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if position < 0 || position > count {
+		position = count
+	}
+	existing := 0
+	err = tx.Model(&ReadingListItem{}).Where("reading_list_id = ? AND post_id = ?", l.ID, pid).Count(&existing).Error
+	if err != nil || existing > 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Model(&ReadingListItem{}).Where("reading_list_id = ? AND position >= ?", l.ID, position).
+		UpdateColumn("position", gorm.Expr("position + 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	item := ReadingListItem{ReadingListID: l.ID, PostID: pid, Position: position, CreatedAt: time.Now()}
+	err = tx.Create(&item).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit().Error
+}
+
+// RemovePost takes the post out of the list and closes the gap.
+func (l *ReadingList) RemovePost(db *gorm.DB, pid uint64) (int64, error) {
+	item := ReadingListItem{}
+	err := db.Where("reading_list_id = ? AND post_id = ?", l.ID, pid).Take(&item).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tx := db.Begin()
+	result := tx.Delete(&item)
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, result.Error
+	}
+	err = tx.Model(&ReadingListItem{}).Where("reading_list_id = ? AND position > ?", l.ID, item.Position).
+		UpdateColumn("position", gorm.Expr("position - 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return result.RowsAffected, tx.Commit().Error
+}
+
+// ReorderPosts puts the posts of the list in the given order, which must
+// name each of them once.
+func (l *ReadingList) ReorderPosts(db *gorm.DB, order []uint64) error {
+	var listed []uint64
+	err := db.Model(&ReadingListItem{}).Where("reading_list_id = ?", l.ID).Pluck("post_id", &listed).Error
+	if err != nil {
+		return err
+	}
+	if len(order) != len(listed) {
+		return ErrReadingListOrder
+	}
+	positions := make(map[uint64]int, len(order))
+	for i, pid := range order {
+		positions[pid] = i
+	}
+	for _, pid := range listed {
+		if _, ok := positions[pid]; !ok {
+			return ErrReadingListOrder
+		}
+	}
+
+	tx := db.Begin()
+	for pid, position := range positions {
+		err = tx.Model(&ReadingListItem{}).Where("reading_list_id = ? AND post_id = ?", l.ID, pid).
+			UpdateColumn("position", position).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
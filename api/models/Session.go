@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrSessionRevoked = errors.New("Session revoked")
+	ErrSessionExpired = errors.New("Session expired")
+)
+
+// Session is created for every issued token and linked to it by the
+// token's jti claim. It expires with the token, or later when it signed
+// links that live longer, and is listed until then.
+type Session struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	JTI        string     `gorm:"size:64;not null;unique" json:"-"`
+	UserID     uint32     `gorm:"not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	IP         string     `gorm:"size:45" json:"ip"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `gorm:"-" json:"current"`
+}
+
+func (s *Session) SaveSession(db *gorm.DB) (*Session, error) {
+	s.CreatedAt = time.Now()
+	s.LastSeenAt = s.CreatedAt
+	err := db.Create(s).Error
+	if err != nil {
+		return &Session{}, err
+	}
+	return s, nil
+}
+
+func (s *Session) FindUserSessions(db *gorm.DB, uid uint32) (*[]Session, error) {
+	var sessions []Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", uid, time.Now()).Order("last_seen_at desc").Find(&sessions).Error
+	if err != nil {
+		return &[]Session{}, err
+	}
+	return &sessions, nil
+}
+
+func (s *Session) RevokeSession(db *gorm.DB, id uint64, uid uint32) (int64, error) {
+	db = db.Model(&Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, uid).UpdateColumn("revoked_at", time.Now())
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// ExtendSession keeps the user's session with the jti until at least the
+// given time, for the links it signs.
+func (s *Session) ExtendSession(db *gorm.DB, jti string, uid uint32, until time.Time) error {
+	return db.Model(&Session{}).Where("jti = ? AND user_id = ? AND expires_at < ?", jti, uid, until).UpdateColumn("expires_at", until).Error
+}
+
+// RevokeUserSessions revokes every session of the user except the one with
+// the given jti, which may be empty to revoke them all.
+func (s *Session) RevokeUserSessions(db *gorm.DB, uid uint32, exceptJTI string) (int64, error) {
+	db = db.Model(&Session{}).Where("user_id = ? AND jti <> ? AND revoked_at IS NULL", uid, exceptJTI).UpdateColumn("revoked_at", time.Now())
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// SessionStore checks tokens against their session records.
+type SessionStore struct {
+	DB *gorm.DB
+}
+
+func (store SessionStore) ValidateSession(jti string, uid uint32) error {
+	s := Session{}
+	err := store.DB.Where("jti = ? AND user_id = ?", jti, uid).Take(&s).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	if s.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return ErrSessionExpired
+	}
+	// Last seen only needs minute precision, which saves a write per request.
+	if time.Since(s.LastSeenAt) > time.Minute {
+		return store.DB.Model(&s).UpdateColumn("last_seen_at", time.Now()).Error
+	}
+	return nil
+}
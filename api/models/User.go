@@ -1,28 +1,35 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"html"
-	"log"
 	"strings"
 	"time"
 
 	"github.com/badoux/checkmail"
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/tracing"
 )
 
 type User struct {
-	ID        uint32    `gorm:"pimary_key;auto_increment" json:"id"`
-	Nickname  string    `gorm:"size:255;not null;unique" json:"nickname"`
-	Email     string    `gorm:"size:100;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;" json:"password"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID        uint32     `gorm:"pimary_key;auto_increment" json:"id"`
+	Nickname  string     `gorm:"size:255;not null;unique" json:"nickname"`
+	Email     string     `gorm:"size:100;not null;unique" json:"email"`
+	Password  string     `gorm:"size:255;not null;" json:"-"`
+	Version   uint32     `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
+	Admin     bool       `gorm:"not null;default:false" json:"-"`
 }
 
-func (u *User) BeforeSave() error {
-	hashedPassword, err := Hash(u.Password)
+// BeforeCreate hashes the plain text password of a new user. Updates never
+// go through it, so a stored hash is never hashed again.
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	hashedPassword, err := HashContext(tracing.Context(tx), u.Password)
 	if err != nil {
 		return err
 	}
@@ -33,13 +40,32 @@ func (u *User) BeforeSave() error {
 func (u *User) Prepare() {
 	u.ID = 0
 	u.Nickname = html.EscapeString(strings.TrimSpace(u.Nickname))
-	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
+	u.Email = html.EscapeString(strings.ToLower(strings.TrimSpace(u.Email)))
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
 }
 
 func (u *User) Validate(action string) error {
 	switch strings.ToLower(action) {
+	case "update":
+		if u.Nickname == "" {
+			return errors.New("Required Nickname")
+		}
+		if u.Email == "" {
+			return errors.New("Required Email")
+		}
+		if err := checkmail.ValidateFormat(u.Email); err != nil {
+			return errors.New("Invalid Email")
+		}
+		if err := auth.Policy.CheckNickname(u.Nickname); err != nil {
+			return err
+		}
+		return nil
+	case "password":
+		if u.Password == "" {
+			return errors.New("Required Password")
+		}
+		return auth.Policy.CheckPassword(u.Password)
 	case "login":
 		if u.Password == "" {
 			return errors.New("Required Password")
@@ -64,12 +90,18 @@ func (u *User) Validate(action string) error {
 		if err := checkmail.ValidateFormat(u.Email); err != nil {
 			return errors.New("Invalid Email")
 		}
+		if err := auth.Policy.CheckNickname(u.Nickname); err != nil {
+			return err
+		}
+		if err := auth.Policy.CheckPassword(u.Password); err != nil {
+			return err
+		}
 		return nil
 	}
 }
 
 func (u *User) SaveUser(db *gorm.DB) (*User, error) {
-	err := db.Debug().Create(u).Error
+	err := db.Create(u).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -78,7 +110,7 @@ func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 
 func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
 	var users []User
-	err := db.Debug().Limit(100).Find(&users).Error
+	err := db.Limit(100).Find(&users).Error
 	if err != nil {
 		return &[]User{}, err
 	}
@@ -86,48 +118,109 @@ func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
 }
 
 func (u *User) FindUserByID(db *gorm.DB, uid uint32) (*User, error) {
-	err := db.Debug().First(u, uid).Error
+	err := db.First(u, uid).Error
 	if err != nil {
 		return &User{}, err
 	}
 	return u, err
 }
 
-func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
-	err := u.BeforeSave()
+// FindUserByEmail finds the user whatever the case of the email. Emails
+// are stored in lower case, except those of older accounts.
+func (u *User) FindUserByEmail(db *gorm.DB, email string) (*User, error) {
+	err := db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).Take(u).Error
 	if err != nil {
-		log.Fatal(err)
+		return &User{}, err
 	}
-	db = db.Debug().Model(u).Where("id = ?", uid).UpdateColumns(
+	return u, err
+}
+
+// UpdateAUser saves the profile fields if the user is still at the version
+// the changes were based on, and reloads it. ErrVersionConflict means
+// someone else saved the user in between. The password is only changed
+// through UpdatePassword.
+func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
+	result := db.Model(&User{}).Where("id = ? AND version = ?", uid, u.Version).UpdateColumns(
 		map[string]interface{}{
-			"password":   u.Password,
 			"nickname":   u.Nickname,
 			"email":      u.Email,
+			"version":    gorm.Expr("version + 1"),
 			"updated_at": time.Now(),
 		},
 	)
-	if db.Error != nil {
-		return &User{}, db.Error
+	if result.Error != nil {
+		return &User{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &User{}, ErrVersionConflict
 	}
-	err = db.Debug().First(u, uid).Error
+	err := db.First(u, uid).Error
 	if err != nil {
 		return &User{}, err
 	}
 	return u, err
 }
 
+// DeleteAUser moves the user to the trash together with their posts. The
+// posts get the same deletion time, which is how RestoreUser tells them
+// apart from posts deleted on their own.
 func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
-	db = db.Debug().Where("id = ?", uid).Delete(u)
-	if db.Error != nil {
-		return 0, db.Error
+	now := time.Now()
+	tx := db.Begin()
+	result := tx.Model(&User{}).Where("id = ?", uid).UpdateColumn("deleted_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, result.Error
+	}
+	err := tx.Model(&Post{}).Where("author_id = ?", uid).UpdateColumn("deleted_at", now).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
 	}
-	return db.RowsAffected, nil
+	return result.RowsAffected, tx.Commit().Error
 }
 
 func Hash(password string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.HashPassword(password)
+	return []byte(hashedPassword), err
 }
 
 func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return auth.VerifyPassword(hashedPassword, password)
+}
+
+// HashContext and VerifyPasswordContext trace the deliberately slow password
+// hashing under the context's span.
+func HashContext(ctx context.Context, password string) ([]byte, error) {
+	_, span := tracing.Start(ctx, "password.hash")
+	hashedPassword, err := Hash(password)
+	tracing.End(span, err)
+	return hashedPassword, err
+}
+
+func VerifyPasswordContext(ctx context.Context, hashedPassword, password string) error {
+	_, span := tracing.Start(ctx, "password.verify")
+	err := VerifyPassword(hashedPassword, password)
+	tracing.End(span, nil)
+	return err
+}
+
+// UpdatePassword stores a new hash of the plain text password, made with the
+// current default hasher and parameters.
+func (u *User) UpdatePassword(db *gorm.DB, password string) error {
+	hashedPassword, err := HashContext(tracing.Context(db), password)
+	if err != nil {
+		return err
+	}
+	err = db.Model(u).UpdateColumns(
+		map[string]interface{}{
+			"password":   string(hashedPassword),
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return err
+	}
+	u.Password = string(hashedPassword)
+	return nil
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PostFields are the post columns that can be selected. The ID and author
+// are always loaded, since the relations are looked up by them.
+var PostFields = []string{"id", "title", "content", "author_id", "created_at", "updated_at"}
+
+// ParsePostFields turns a comma separated field list into the columns to
+// select. An empty list selects every column.
+func ParsePostFields(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	fields := []string{"id", "author_id"}
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		known := false
+		for _, pf := range PostFields {
+			known = known || f == pf
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown Field %s", f)
+		}
+		if f != "id" && f != "author_id" {
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// selectFields restricts the query to the given columns of the table.
+func selectFields(db *gorm.DB, table string, fields []string) *gorm.DB {
+	if len(fields) == 0 {
+		return db
+	}
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = table + "." + f
+	}
+	return db.Select(columns)
+}
+
+// postLoaders fill in the relations of a batch of posts, each with a
+// constant number of queries however many posts there are.
+var postLoaders = []func(db *gorm.DB, posts []*Post) error{
+	LoadAuthors,
+	LoadReactionCounts,
+	LoadMentions,
+}
+
+// LoadPostRelations runs every post loader on the posts.
+func LoadPostRelations(db *gorm.DB, posts ...*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	for _, load := range postLoaders {
+		err := load(db, posts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadAuthors fetches the authors of the posts in a single query.
+func LoadAuthors(db *gorm.DB, posts []*Post) error {
+	ids := make([]uint32, 0, len(posts))
+	seen := map[uint32]bool{}
+	for _, p := range posts {
+		if !seen[p.AuthorID] {
+			seen[p.AuthorID] = true
+			ids = append(ids, p.AuthorID)
+		}
+	}
+
+	var users []User
+	err := db.Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return err
+	}
+	authors := make(map[uint32]User, len(users))
+	for _, u := range users {
+		authors[u.ID] = u
+	}
+	for _, p := range posts {
+		p.Author = authors[p.AuthorID]
+	}
+	return nil
+}
+
+// PostPointers points to each of the posts, for the loaders.
+func PostPointers(posts []Post) []*Post {
+	ptrs := make([]*Post, len(posts))
+	for i := range posts {
+		ptrs[i] = &posts[i]
+	}
+	return ptrs
+}
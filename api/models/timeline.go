@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrInvalidCursor = errors.New("Invalid Cursor")
+
+// TimelineCursor is the position of the last post of a timeline page. The
+// next page continues with the posts created before it, so new posts do
+// not shift the pages a reader is scrolling through.
+type TimelineCursor struct {
+	CreatedAt time.Time
+	ID        uint64
+}
+
+func (c TimelineCursor) String() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseTimelineCursor reads a cursor made by TimelineCursor.String. The
+// empty cursor is the start of the timeline.
+func ParseTimelineCursor(s string) (*TimelineCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var nanos int64
+	var id uint64
+	_, err = fmt.Sscanf(string(raw), "%d:%d", &nanos, &id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &TimelineCursor{CreatedAt: time.Unix(0, nanos), ID: id}, nil
+}
+
+// FindTimeline returns a page of the posts of the user and of the authors
+// they follow, newest first, with the cursor of the next page or nil on
+// the last one. The posts are gathered when read through the follows of
+// the user and the authors' index on the posts, so following someone shows
+// their earlier posts too.
+func FindTimeline(db *gorm.DB, uid uint32, cursor *TimelineCursor, limit int) (*[]Post, *TimelineCursor, error) {
+	followed := db.Model(&Follow{}).Select("followed_id").Where("follower_id = ?", uid).QueryExpr()
+	query := db.Where("posts.author_id = ? OR posts.author_id IN (?)", uid, followed)
+	if cursor != nil {
+		query = query.Where("posts.created_at < ? OR (posts.created_at = ? AND posts.id < ?)", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	var posts []Post
+	err := query.Order("posts.created_at desc, posts.id desc").Limit(limit + 1).Find(&posts).Error
+	if err != nil {
+		return &[]Post{}, nil, err
+	}
+	var next *TimelineCursor
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		next = &TimelineCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	err = LoadPostRelations(db, PostPointers(posts)...)
+	if err != nil {
+		return &[]Post{}, nil, err
+	}
+	return &posts, next, nil
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Deleted posts and users stay in the trash, hidden from every other
+// finder by gorm's soft delete, until they are restored or purged.
+
+var (
+	ErrPostNotInTrash = errors.New("Post not found in trash")
+	ErrUserNotInTrash = errors.New("User not found in trash")
+	ErrAuthorInTrash  = errors.New("Author is deleted")
+)
+
+// FindDeletedPosts lists the posts in the trash, only those of the author
+// unless authorID is 0.
+func (p *Post) FindDeletedPosts(db *gorm.DB, authorID uint32) (*[]Post, error) {
+	var posts []Post
+	query := db.Unscoped().Where("deleted_at IS NOT NULL")
+	if authorID != 0 {
+		query = query.Where("author_id = ?", authorID)
+	}
+	err := query.Order("deleted_at desc").Limit(100).Find(&posts).Error
+	if err != nil {
+		return &[]Post{}, err
+	}
+	// Posts deleted with their author still show who wrote them.
+	err = LoadPostRelations(db.Unscoped(), PostPointers(posts)...)
+	if err != nil {
+		return &[]Post{}, err
+	}
+	return &posts, nil
+}
+
+// FindDeletedPost finds a post in the trash.
+func (p *Post) FindDeletedPost(db *gorm.DB, pid uint64) (*Post, error) {
+	err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", pid).Take(p).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Post{}, ErrPostNotInTrash
+		}
+		return &Post{}, err
+	}
+	return p, nil
+}
+
+// RestorePost takes the post out of the trash. Posts of deleted users come
+// back with their author, see RestoreUser.
+func (p *Post) RestorePost(db *gorm.DB, pid uint64) (*Post, error) {
+	_, err := p.FindDeletedPost(db, pid)
+	if err != nil {
+		return &Post{}, err
+	}
+	author := User{}
+	_, err = author.FindUserByID(db, p.AuthorID)
+	if gorm.IsRecordNotFoundError(err) {
+		return &Post{}, ErrAuthorInTrash
+	}
+	if err != nil {
+		return &Post{}, err
+	}
+
+	err = db.Unscoped().Model(&Post{}).Where("id = ?", pid).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return &Post{}, err
+	}
+	return p.FindPostByID(db, pid)
+}
+
+// FindDeletedUsers lists the users in the trash.
+func (u *User) FindDeletedUsers(db *gorm.DB) (*[]User, error) {
+	var users []User
+	err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Limit(100).Find(&users).Error
+	if err != nil {
+		return &[]User{}, err
+	}
+	return &users, nil
+}
+
+// RestoreUser takes the user out of the trash together with the posts
+// that were deleted with them.
+func (u *User) RestoreUser(db *gorm.DB, uid uint32) (*User, error) {
+	err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", uid).Take(u).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &User{}, ErrUserNotInTrash
+		}
+		return &User{}, err
+	}
+
+	tx := db.Begin()
+	err = tx.Unscoped().Model(&Post{}).Where("author_id = ? AND deleted_at = ?", uid, u.DeletedAt).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	err = tx.Unscoped().Model(&User{}).Where("id = ?", uid).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &User{}, err
+	}
+	return u.FindUserByID(db, uid)
+}
+
+// postRecords and userRecords refer to a post by its post_id or to a user
+// by their user_id, and are purged with them.
+var (
+	postRecords = []interface{}{&Reaction{}, &Bookmark{}, &ReadingListItem{}, &Mention{}, &Notification{}}
+	userRecords = []interface{}{&Session{}, &Identity{}, &Reaction{}, &Bookmark{}, &Mention{}, &Notification{}, &NotificationPreference{}}
+)
+
+// deletePostRecords removes the records referring to the posts selected by
+// the subquery.
+func deletePostRecords(db *gorm.DB, posts *gorm.SqlExpr) error {
+	for _, model := range postRecords {
+		err := db.Where("post_id IN (?)", posts).Delete(model).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes the posts and users that were moved to
+// the trash before the given time, along with the records referring to
+// them: reactions, bookmarks, reading list entries, mentions and
+// notifications of the purged posts, and the purged users' sessions, linked
+// identities, reactions, bookmarks, mentions, reading lists, follows and
+// notifications, both received and caused, with their notification
+// preferences.
+func PurgeDeleted(db *gorm.DB, before time.Time) (posts int64, users int64, err error) {
+	err = deletePostRecords(db, db.Unscoped().Model(&Post{}).Where("deleted_at < ?", before).Select("id").QueryExpr())
+	if err != nil {
+		return 0, 0, err
+	}
+	result := db.Unscoped().Where("deleted_at < ?", before).Delete(&Post{})
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+	posts = result.RowsAffected
+
+	var ids []uint32
+	err = db.Unscoped().Model(&User{}).Where("deleted_at < ?", before).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return posts, 0, err
+	}
+	tx := db.Begin()
+	for _, model := range userRecords {
+		err = tx.Where("user_id IN (?)", ids).Delete(model).Error
+		if err != nil {
+			tx.Rollback()
+			return posts, 0, err
+		}
+	}
+	err = tx.Where("follower_id IN (?) OR followed_id IN (?)", ids, ids).Delete(&Follow{}).Error
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	err = tx.Where("actor_id IN (?)", ids).Delete(&Notification{}).Error
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	lists := tx.Model(&ReadingList{}).Where("user_id IN (?)", ids).Select("id").QueryExpr()
+	err = tx.Where("reading_list_id IN (?)", lists).Delete(&ReadingListItem{}).Error
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	err = tx.Where("user_id IN (?)", ids).Delete(&ReadingList{}).Error
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	// Any posts of theirs still left would be cascaded by the foreign key.
+	err = deletePostRecords(tx, tx.Unscoped().Model(&Post{}).Where("author_id IN (?)", ids).Select("id").QueryExpr())
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	err = tx.Unscoped().Where("author_id IN (?)", ids).Delete(&Post{}).Error
+	if err != nil {
+		tx.Rollback()
+		return posts, 0, err
+	}
+	result = tx.Unscoped().Where("id IN (?)", ids).Delete(&User{})
+	if result.Error != nil {
+		tx.Rollback()
+		return posts, 0, result.Error
+	}
+	return posts, result.RowsAffected, tx.Commit().Error
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory delivers events to the streams open on this instance only.
+type Memory struct {
+	mu   sync.Mutex
+	subs map[uint32]map[chan Event]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: map[uint32]map[chan Event]struct{}{}}
+}
+
+func (m *Memory) Publish(ctx context.Context, uid uint32, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs[uid] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, uid uint32) (<-chan Event, error) {
+	ch := make(chan Event, subscriberBuffer)
+	m.mu.Lock()
+	if m.subs[uid] == nil {
+		m.subs[uid] = map[chan Event]struct{}{}
+	}
+	m.subs[uid][ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subs[uid], ch)
+		if len(m.subs[uid]) == 0 {
+			delete(m.subs, uid)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Event is a message for the open streams of one user, written to them as
+// a Server-Sent Event.
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"event"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Encode formats the event for a text/event-stream response. Data is
+// compact JSON, so it fits on a single data line.
+func (e Event) Encode() []byte {
+	var b bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Name)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", e.Data)
+	return b.Bytes()
+}
+
+// Broker delivers events to the streams a user has open. Delivery is best
+// effort: streams that fall behind lose events, and catch up from the
+// database instead.
+type Broker interface {
+	Publish(ctx context.Context, uid uint32, event Event) error
+	// Subscribe returns the events of the user until ctx is done, when
+	// the channel is closed.
+	Subscribe(ctx context.Context, uid uint32) (<-chan Event, error)
+}
+
+// subscriberBuffer is how many events a stream may fall behind.
+const subscriberBuffer = 16
+
+// FromEnv returns the broker chosen by NOTIFY_BROKER: "memory" (the
+// default) for a single instance, "redis" to reach the streams open on
+// every instance through the server at REDIS_URL, or "none" to leave the
+// streams to poll the database.
+func FromEnv() (Broker, error) {
+	switch backend := strings.ToLower(os.Getenv("NOTIFY_BROKER")); backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return NewRedis(redis.NewClient(opts)), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFY_BROKER %q", backend)
+	}
+}
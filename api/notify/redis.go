@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis delivers events through the pub/sub channels of a Redis compatible
+// server, one per user, so that they reach the streams open on every
+// instance of the API.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{Client: client, Prefix: "blogiris:notifications:"}
+}
+
+func (b *Redis) channel(uid uint32) string {
+	return b.Prefix + strconv.FormatUint(uint64(uid), 10)
+}
+
+func (b *Redis) Publish(ctx context.Context, uid uint32, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(ctx, b.channel(uid), payload).Err()
+}
+
+func (b *Redis) Subscribe(ctx context.Context, uid uint32) (<-chan Event, error) {
+	pubsub := b.Client.Subscribe(ctx, b.channel(uid))
+	// Waiting for the confirmation makes sure no event published after
+	// Subscribe returns is missed.
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	go func() {
+		defer close(ch)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				event := Event{}
+				if json.Unmarshal([]byte(msg.Payload), &event) != nil {
+					continue
+				}
+				select {
+				case ch <- event:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Ping lets readiness check the Redis server.
+func (b *Redis) Ping(ctx context.Context) error {
+	return b.Client.Ping(ctx).Err()
+}
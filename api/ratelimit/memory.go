@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many buckets may be created between sweeps of the
+// ones that have refilled.
+const sweepEvery = 1024
+
+// Memory keeps the buckets in process, which only limits a single instance.
+type Memory struct {
+	// Now is the clock, replaceable in tests.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	created int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{Now: time.Now, buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	now := m.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		m.sweep(now)
+		b = &bucket{tokens: p.burst(), last: now}
+		m.buckets[key] = b
+	}
+	res, tokens := take(p, b.tokens, b.last, now)
+	b.tokens, b.last, b.full = tokens, now, now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops the buckets that are full again, since a new bucket is the
+// same as a full one. It runs every sweepEvery new buckets so that the
+// cost stays constant per request.
+func (m *Memory) sweep(now time.Time) {
+	m.created++
+	if m.created < sweepEvery {
+		return
+	}
+	m.created = 0
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Policy is a token bucket: it holds up to Burst requests and refills
+// Limit of them every Period.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// rate is the number of tokens added per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+func (p Policy) burst() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Limit)
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, zero if
+	// it already is.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps the buckets. Take takes one token from the bucket of the key,
+// creating a full one if there is none.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// take applies the token bucket to a bucket holding tokens at last, and
+// returns the tokens left at now.
+func take(p Policy, tokens float64, last, now time.Time) (Result, float64) {
+	burst := p.burst()
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*p.rate())
+	}
+	res := Result{Limit: int(burst)}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / p.rate())
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((burst - tokens) / p.rate())
+	return res, tokens
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ParsePolicy reads a policy written as "<limit>/<period>", optionally
+// followed by ",burst=<n>", for example "10/1m" or "100/1h,burst=20". The
+// spec "off" returns nil, which disables the policy.
+func ParsePolicy(name, spec string) (*Policy, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.EqualFold(spec, "off") {
+		return nil, nil
+	}
+	rule, options, _ := strings.Cut(spec, ",")
+	limit, period, ok := strings.Cut(rule, "/")
+	if !ok {
+		return nil, fmt.Errorf("rate limit %s: expected <limit>/<period>, got %q", name, spec)
+	}
+	p := Policy{Name: name}
+	var err error
+	p.Limit, err = strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || p.Limit < 1 {
+		return nil, fmt.Errorf("rate limit %s: invalid limit %q", name, limit)
+	}
+	p.Period, err = time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || p.Period <= 0 {
+		return nil, fmt.Errorf("rate limit %s: invalid period %q", name, period)
+	}
+	if options != "" {
+		burst, ok := strings.CutPrefix(strings.TrimSpace(options), "burst=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %s: unknown option %q", name, options)
+		}
+		p.Burst, err = strconv.Atoi(burst)
+		if err != nil || p.Burst < 1 {
+			return nil, fmt.Errorf("rate limit %s: invalid burst %q", name, burst)
+		}
+	}
+	return &p, nil
+}
+
+// PolicyFromEnv reads the policy from RATE_LIMIT_<NAME>, falling back to
+// the given spec when it is not set.
+func PolicyFromEnv(name, fallback string) (*Policy, error) {
+	spec := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name))
+	if spec == "" {
+		spec = fallback
+	}
+	return ParsePolicy(name, spec)
+}
+
+// FromEnv returns the store chosen by RATE_LIMIT_STORE: "memory" (the
+// default) for a single instance, "redis" to share the buckets of every
+// instance through the server at REDIS_URL, or "none" to disable limits.
+func FromEnv() (Store, error) {
+	switch backend := strings.ToLower(os.Getenv("RATE_LIMIT_STORE")); backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return NewRedis(redis.NewClient(opts)), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", backend)
+	}
+}
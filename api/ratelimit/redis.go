@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket atomically, so that
+// instances sharing the server cannot race each other. The bucket expires
+// once it would be full again.
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1]) or burst
+local last = tonumber(bucket[2]) or now
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Redis keeps the buckets in a Redis compatible server, so that every
+// instance of the API shares them. The clocks of the instances should be
+// in sync, since each one passes its own time.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	// Now is the clock, replaceable in tests.
+	Now func() time.Time
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{Client: client, Prefix: "blogiris:ratelimit:", Now: time.Now}
+}
+
+func (s *Redis) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	now := s.Now()
+	reply, err := takeScript.Run(ctx, s.Client, []string{s.Prefix + key},
+		p.burst(), p.rate(), now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := reply[0].(int64)
+	left, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// The script already took the token, so only the headers are derived
+	// here, from the tokens that were there before.
+	before := tokens
+	if allowed == 1 {
+		before++
+	}
+	res, _ := take(p, before, now, now)
+	return res, nil
+}
+
+// Ping lets readiness check the Redis server.
+func (s *Redis) Ping(ctx context.Context) error {
+	return s.Client.Ping(ctx).Err()
+}
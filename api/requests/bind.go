@@ -0,0 +1,121 @@
+package requests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodySize applies to routes without a limit of their own.
+const DefaultMaxBodySize int64 = 1 << 20
+
+type maxBodySizeKey struct{}
+
+// WithMaxBodySize sets the body size limit of the request's route.
+func WithMaxBodySize(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, maxBodySizeKey{}, n)
+}
+
+func maxBodySize(ctx context.Context) int64 {
+	if n, ok := ctx.Value(maxBodySizeKey{}).(int64); ok && n > 0 {
+		return n
+	}
+	return DefaultMaxBodySize
+}
+
+// Error is a body that could not be bound, with the status to answer it.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(status int, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// Bind decodes the JSON body of the request into v, which should be a
+// request type rather than a model, and validates it. The body must be
+// sent as application/json, fit in the route's size limit and hold exactly
+// one object without fields v does not have. The errors are *Error values.
+func Bind(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return newError(http.StatusUnsupportedMediaType, "Content-Type Must Be application/json")
+	}
+
+	limit := maxBodySize(r.Context())
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(v)
+	if err != nil {
+		return decodeError(err, limit)
+	}
+	err = dec.Decode(&struct{}{})
+	if err == io.EOF {
+		return Validate(v)
+	}
+	if err != nil {
+		if bindErr := decodeError(err, limit); bindErr.Status == http.StatusRequestEntityTooLarge {
+			return bindErr
+		}
+	}
+	return newError(http.StatusBadRequest, "Request Body Must Contain A Single JSON Object")
+}
+
+// decodeError turns the errors of encoding/json into messages that point
+// at the offending part of the body.
+func decodeError(err error, limit int64) *Error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return newError(http.StatusRequestEntityTooLarge, "Request Body Too Large, The Limit Is %d Bytes", limit)
+	case errors.Is(err, io.EOF):
+		return newError(http.StatusBadRequest, "Request Body Is Empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return newError(http.StatusBadRequest, "Malformed JSON, The Body Ends Unexpectedly")
+	case errors.As(err, &syntaxErr):
+		return newError(http.StatusBadRequest, "Malformed JSON At Offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return newError(http.StatusBadRequest, "Request Body Must Be A JSON Object")
+		}
+		return newError(http.StatusUnprocessableEntity, "Field %s Must Be %s", typeErr.Field, jsonType(typeErr.Type.String()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return newError(http.StatusUnprocessableEntity, "Unknown Field %s", field)
+	default:
+		return newError(http.StatusBadRequest, "%s", err.Error())
+	}
+}
+
+// jsonType names a Go type the way a client sending JSON would.
+func jsonType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case goType == "string":
+		return "A String"
+	case goType == "bool":
+		return "A Boolean"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "An Integer"
+	case strings.HasPrefix(goType, "float"):
+		return "A Number"
+	case strings.HasPrefix(goType, "[]"):
+		return "An Array"
+	default:
+		return "An Object"
+	}
+}
@@ -0,0 +1,148 @@
+package requests
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/badoux/checkmail"
+)
+
+// Validate checks the validate tags of a request type's fields and returns
+// an *Error for the first field breaking its rules. The rules are
+//
+//	required  the field must not be empty, spaces aside
+//	max=N     strings have at most N characters, numbers are at most N
+//	min=N     strings have at least N characters, numbers are at least N
+//	email     the string is an email address
+//
+// Fields are named after their JSON keys. Nil pointers are fields the
+// client left out of a partial update and are not checked at all, while
+// the values of the others must follow the rules. Embedded structs are
+// validated in place.
+func Validate(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	return validateStruct(value)
+}
+
+func validateStruct(value reflect.Value) error {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := validateStruct(value.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		if err := validateField(fieldName(field), value.Field(i), rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldName turns the JSON key of the field into the words of the error
+// messages, such as "Current Password" for current_password and "Post ID"
+// for post_id.
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	words := strings.Split(name, "_")
+	for i, w := range words {
+		if w == "id" {
+			words[i] = "ID"
+		} else if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func validateField(name string, value reflect.Value, rules string) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch rule {
+		case "required":
+			if isEmpty(value) {
+				return invalid("Required %s", name)
+			}
+		case "email":
+			if value.Kind() == reflect.String && value.String() != "" && checkmail.ValidateFormat(strings.TrimSpace(value.String())) != nil {
+				return invalid("Invalid %s", name)
+			}
+		case "max", "min":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("requests: invalid %s rule %q on %s", rule, arg, name))
+			}
+			if err := checkBound(name, value, rule, limit); err != nil {
+				return err
+			}
+		default:
+			panic(fmt.Sprintf("requests: unknown validation rule %q on %s", rule, name))
+		}
+	}
+	return nil
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+func checkBound(name string, value reflect.Value, rule string, limit float64) error {
+	var n float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(value.String())), " Characters"
+	case reflect.Slice, reflect.Map:
+		n, unit = float64(value.Len()), " Items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		return nil
+	}
+	bound := strconv.FormatFloat(limit, 'f', -1, 64)
+	if rule == "max" && n > limit {
+		return invalid("%s Must Be At Most %s%s", name, bound, unit)
+	}
+	if rule == "min" && n < limit {
+		return invalid("%s Must Be At Least %s%s", name, bound, unit)
+	}
+	return nil
+}
+
+func invalid(format string, args ...interface{}) *Error {
+	return newError(http.StatusUnprocessableEntity, format, args...)
+}
@@ -25,3 +25,27 @@ func Error(w http.ResponseWriter, statusCode int, err error) {
 	}
 	JSON(w, http.StatusBadRequest, nil)
 }
+
+// Problem writes an RFC 7807 problem details response.
+func Problem(w http.ResponseWriter, statusCode int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	JSON(w, statusCode, struct {
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Status    int    `json:"status"`
+		Detail    string `json:"detail,omitempty"`
+		RequestID string `json:"request_id,omitempty"`
+	}{
+		Type:      "about:blank",
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    detail,
+		RequestID: w.Header().Get("X-Request-ID"),
+	})
+}
+
+// NoContent writes a 204 response, which must not have a body.
+func NoContent(w http.ResponseWriter) {
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
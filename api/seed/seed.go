@@ -34,17 +34,17 @@ var posts = []models.Post{
 
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Post{}, &models.User{}).Error
+	err := db.DropTableIfExists(&models.Mention{}, &models.NotificationPreference{}, &models.Notification{}, &models.ReadingListItem{}, &models.ReadingList{}, &models.Bookmark{}, &models.Follow{}, &models.Reaction{}, &models.Post{}, &models.Identity{}, &models.OneTimeToken{}, &models.Session{}, &models.User{}).Error
 	if err != nil {
 		log.Fatalf("cannot drop table: %v", err)
 	}
 
-	err = db.Debug().AutoMigrate(&models.User{}, &models.Post{}).Error
+	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Identity{}, &models.OneTimeToken{}, &models.Session{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{}).Error
 	if err != nil {
 		log.Fatalf("cannot migrate table: %v", err)
 	}
 
-	err = db.Debug().Model(&models.Post{}).AddForeignKey("author_id", "users(id)", "cascade", "cascade").Error
+	err = db.Model(&models.Post{}).AddForeignKey("author_id", "users(id)", "cascade", "cascade").Error
 	if err != nil {
 		log.Fatalf("attaching foreign key error: %v", err)
 	}
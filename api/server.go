@@ -1,11 +1,15 @@
 package api
 
 import (
+	"context"
+
 	"github.com/Funskie/blogIris/api/controllers"
+	"github.com/Funskie/blogIris/api/logger"
 	"github.com/Funskie/blogIris/api/seed"
+	"github.com/Funskie/blogIris/api/tracing"
 
-	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
 	"github.com/joho/godotenv"
@@ -18,9 +22,15 @@ func Run() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error getting env, not comming through %v", err)
-	} else {
-		fmt.Println("We are getting the env values")
 	}
+	logger.Setup(logger.ConfigFromEnv())
+	slog.Info("We are getting the env values")
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("Error setting up tracing %v", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
 
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "tracing:context"
+	spanKey    = "tracing:span"
+)
+
+// WithContext returns a handle whose queries are traced as children of the
+// context's span. gorm v1 has no context of its own, so it is carried as a
+// setting of the handle.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// Context returns the context carried by the handle, or an empty one.
+func Context(db *gorm.DB) context.Context {
+	if v, ok := db.Get(contextKey); ok {
+		if ctx, ok := v.(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// RegisterGormCallbacks starts a span for every query run through a handle
+// from WithContext. Queries without a traced context are left alone.
+func RegisterGormCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("tracing:before_create", before("create"))
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after_create", after)
+	cb.Query().Before("gorm:query").Register("tracing:before_query", before("query"))
+	cb.Query().After("gorm:after_query").Register("tracing:after_query", after)
+	cb.Update().Before("gorm:begin_transaction").Register("tracing:before_update", before("update"))
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after_update", after)
+	cb.Delete().Before("gorm:begin_transaction").Register("tracing:before_delete", before("delete"))
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after_delete", after)
+	cb.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", before("row_query"))
+	cb.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", after)
+}
+
+func before(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		ctx, ok := v.(context.Context)
+		if !ok || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+		table := scope.TableName()
+		_, span := Tracer().Start(ctx, "gorm."+operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", scope.Dialect().GetName()),
+				attribute.String("db.operation.name", operation),
+				attribute.String("db.collection.name", table),
+			))
+		scope.Set(spanKey, span)
+	}
+}
+
+func after(scope *gorm.Scope) {
+	v, ok := scope.Get(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	// The statement only holds placeholders, never the bound values.
+	span.SetAttributes(
+		attribute.String("db.query.text", scope.SQL),
+		attribute.Int64("db.rows_affected", scope.DB().RowsAffected),
+	)
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,140 @@
+package authtests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/auth"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("API_SECRET", "test secret")
+	os.Exit(m.Run())
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	token, err := auth.CreateToken(7, "session")
+	if err != nil {
+		t.Errorf("this is the error creating the token: %v", err)
+	}
+
+	samples := []struct {
+		name         string
+		bearer       string
+		cookie       string
+		query        string
+		queryTokens  bool
+		userID       uint32
+		errorMessage string
+	}{
+		{name: "bearer", bearer: token, userID: 7},
+		{name: "cookie", cookie: token, userID: 7},
+		{name: "query disabled", query: token, errorMessage: "Missing credentials"},
+		{name: "query enabled", query: token, queryTokens: true, userID: 7},
+		{name: "none", errorMessage: "Missing credentials"},
+		// An invalid bearer token is not overridden by a valid cookie.
+		{name: "invalid bearer", bearer: "invalid", cookie: token, errorMessage: "token contains an invalid number of segments"},
+	}
+
+	for _, v := range samples {
+		if v.queryTokens {
+			os.Setenv("AUTH_QUERY_TOKENS", "true")
+		}
+		req := httptest.NewRequest("GET", "/posts?token="+v.query, nil)
+		if v.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+v.bearer)
+		}
+		if v.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: auth.TokenCookie, Value: v.cookie})
+		}
+
+		claims, err := auth.ExtractTokenClaims(req)
+		os.Unsetenv("AUTH_QUERY_TOKENS")
+		if v.errorMessage != "" {
+			if err == nil {
+				t.Errorf("%s: expected the error %s", v.name, v.errorMessage)
+				continue
+			}
+			assert.Equal(t, err.Error(), v.errorMessage)
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: this is the error: %v", v.name, err)
+			continue
+		}
+		assert.Equal(t, claims.UserID, v.userID)
+		assert.Equal(t, claims.ID, "session")
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+
+	auth.Sessions = revokedSessions{"revoked": true}
+	defer func() { auth.Sessions = nil }()
+
+	valid := auth.SignURL("/timeline", 7, "session", time.Now().Add(time.Hour)).Encode()
+	expired := auth.SignURL("/timeline", 7, "session", time.Now().Add(-time.Minute)).Encode()
+	revoked := auth.SignURL("/timeline", 7, "revoked", time.Now().Add(time.Hour)).Encode()
+	moved := strings.Replace(valid, "session=session", "session=other", 1)
+
+	samples := []struct {
+		method       string
+		target       string
+		optIn        bool
+		errorMessage string
+	}{
+		{method: "GET", target: "/timeline?" + valid, optIn: true},
+		{method: "GET", target: "/timeline?" + valid, optIn: false, errorMessage: "Invalid signed URL"},
+		{method: "POST", target: "/timeline?" + valid, optIn: true, errorMessage: "Invalid signed URL"},
+		{method: "GET", target: "/users/me/bookmarks?" + valid, optIn: true, errorMessage: "Invalid signed URL"},
+		{method: "GET", target: "/timeline?" + expired, optIn: true, errorMessage: "Signed URL expired"},
+		{method: "GET", target: "/timeline?" + revoked, optIn: true, errorMessage: "Session revoked"},
+		{method: "GET", target: "/timeline?" + moved, optIn: true, errorMessage: "Invalid signed URL"},
+	}
+
+	for _, v := range samples {
+		var claims *auth.TokenClaims
+		var err error
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			claims, err = auth.ExtractTokenClaims(r)
+		}
+		if v.optIn {
+			handler = auth.AllowSignedURLs(handler)
+		}
+		handler(httptest.NewRecorder(), httptest.NewRequest(v.method, v.target, nil))
+
+		if v.errorMessage != "" {
+			if err == nil {
+				t.Errorf("%s %s: expected the error %s", v.method, v.target, v.errorMessage)
+				continue
+			}
+			assert.Equal(t, err.Error(), v.errorMessage)
+			continue
+		}
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+			continue
+		}
+		assert.Equal(t, claims.UserID, uint32(7))
+		assert.Equal(t, claims.SignedURL, true)
+	}
+}
+
+// revokedSessions is a session store where only the listed sessions are
+// revoked.
+type revokedSessions map[string]bool
+
+func (s revokedSessions) ValidateSession(jti string, userID uint32) error {
+	if s[jti] {
+		return errors.New("Session revoked")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cachetests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/cache"
+)
+
+func newRedis(t *testing.T) (*cache.Redis, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})), mr
+}
+
+func TestCaches(t *testing.T) {
+
+	rc, _ := newRedis(t)
+	samples := []struct {
+		name  string
+		cache cache.Cache
+	}{
+		{name: "memory", cache: cache.NewLRU(10)},
+		{name: "redis", cache: rc},
+	}
+
+	ctx := context.Background()
+	for _, v := range samples {
+		_, found, err := v.cache.Get(ctx, "post:1")
+		if err != nil {
+			t.Errorf("%s: this is the error getting: %v", v.name, err)
+		}
+		assert.Equal(t, found, false)
+
+		err = v.cache.Set(ctx, "post:1", []byte("first"), time.Minute)
+		if err != nil {
+			t.Errorf("%s: this is the error setting: %v", v.name, err)
+		}
+		value, found, err := v.cache.Get(ctx, "post:1")
+		if err != nil {
+			t.Errorf("%s: this is the error getting: %v", v.name, err)
+		}
+		assert.Equal(t, found, true)
+		assert.Equal(t, string(value), "first")
+
+		err = v.cache.Delete(ctx, "post:1", "post:2")
+		if err != nil {
+			t.Errorf("%s: this is the error deleting: %v", v.name, err)
+		}
+		_, found, _ = v.cache.Get(ctx, "post:1")
+		assert.Equal(t, found, false)
+	}
+}
+
+func TestRedisExpiry(t *testing.T) {
+
+	rc, mr := newRedis(t)
+	ctx := context.Background()
+
+	rc.Set(ctx, "post:1", []byte("first"), time.Minute)
+	mr.FastForward(2 * time.Minute)
+
+	_, found, err := rc.Get(ctx, "post:1")
+	if err != nil {
+		t.Errorf("this is the error getting: %v", err)
+	}
+	assert.Equal(t, found, false)
+	assert.Equal(t, mr.Exists("blogiris:post:1"), false)
+}
+
+func TestLRUEviction(t *testing.T) {
+
+	c := cache.NewLRU(2)
+	ctx := context.Background()
+
+	c.Set(ctx, "a", []byte("a"), 0)
+	c.Set(ctx, "b", []byte("b"), 0)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("c"), 0)
+
+	samples := []struct {
+		key   string
+		found bool
+	}{
+		{key: "a", found: true},
+		{key: "b", found: false},
+		{key: "c", found: true},
+	}
+	for _, v := range samples {
+		_, found, _ := c.Get(ctx, v.key)
+		assert.Equal(t, found, v.found)
+	}
+
+	c.Set(ctx, "d", []byte("d"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, found, _ := c.Get(ctx, "d")
+	assert.Equal(t, found, false)
+}
@@ -0,0 +1,97 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestBookmarks(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+	bookmark := "/users/me/bookmarks/" + strconv.Itoa(int(posts[1].ID))
+
+	samples := []struct {
+		method       string
+		target       string
+		token        string
+		statusCode   int
+		errorMessage string
+	}{
+		{method: "PUT", target: bookmark, token: tokenString, statusCode: 201},
+		{method: "PUT", target: bookmark, token: tokenString, statusCode: 200},
+		{method: "PUT", target: "/users/me/bookmarks/999", token: tokenString, statusCode: 404, errorMessage: "Post not found"},
+		{method: "PUT", target: bookmark, token: "", statusCode: 401, errorMessage: "Missing credentials"},
+		{method: "DELETE", target: "/users/me/bookmarks/" + strconv.Itoa(int(posts[0].ID)), token: tokenString, statusCode: 404, errorMessage: "Bookmark not found"},
+	}
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", v.token)
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.errorMessage != "" {
+			responseMap := make(map[string]interface{})
+			err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+			if err != nil {
+				t.Errorf("this is the error convert to json: %v", err)
+			}
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
+	}
+
+	rr := serve("GET", "/users/me/bookmarks", "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var bookmarked []map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &bookmarked)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, len(bookmarked), 1)
+	assert.Equal(t, bookmarked[0]["id"], float64(posts[1].ID))
+
+	// Signed in readers see their bookmarks in a private response, the
+	// shared one has no flag.
+	getPosts := func(token string) (*http.Response, []map[string]interface{}) {
+		rr := serve("GET", "/posts", "", token)
+		var found []map[string]interface{}
+		err := json.Unmarshal(rr.Body.Bytes(), &found)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		return rr.Result(), found
+	}
+	resp, found := getPosts(tokenString)
+	assert.Equal(t, resp.Header.Get("Cache-Control"), "private, no-cache")
+	assert.Equal(t, resp.Header.Get("Last-Modified"), "")
+	for _, p := range found {
+		assert.Equal(t, p["bookmarked"], p["id"] == float64(posts[1].ID))
+	}
+	privateETag := resp.Header.Get("ETag")
+
+	resp, found = getPosts("")
+	assert.Equal(t, resp.Header.Get("Cache-Control"), "public, no-cache")
+	assert.NotEqual(t, resp.Header.Get("ETag"), privateETag)
+	for _, p := range found {
+		_, flagged := p["bookmarked"]
+		assert.Equal(t, flagged, false)
+	}
+
+	rr = serve("DELETE", bookmark, "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	resp, _ = getPosts(tokenString)
+	assert.NotEqual(t, resp.Header.Get("ETag"), privateETag)
+}
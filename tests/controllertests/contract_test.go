@@ -0,0 +1,223 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// These tests go through the router, so they also cover the headers and
+// status codes the route configuration is responsible for.
+
+func serve(method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestContractMethodNotAllowed(t *testing.T) {
+
+	samples := []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{method: "PATCH", target: "/posts", allow: "GET, POST, OPTIONS"},
+		{method: "DELETE", target: "/users", allow: "GET, POST, OPTIONS"},
+		{method: "POST", target: "/posts/1", allow: "GET, PUT, DELETE, OPTIONS"},
+		{method: "POST", target: "/users/1", allow: "GET, PUT, PATCH, DELETE, OPTIONS"},
+		{method: "GET", target: "/login", allow: "POST, OPTIONS"},
+	}
+
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", "")
+
+		assert.Equal(t, rr.Code, http.StatusMethodNotAllowed)
+		assert.Equal(t, rr.Header().Get("Allow"), v.allow)
+		assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+		responseMap := make(map[string]interface{})
+		err := json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, responseMap["error"], "Method Not Allowed")
+	}
+}
+
+func TestContractOptions(t *testing.T) {
+
+	samples := []struct {
+		target     string
+		statusCode int
+		allow      string
+	}{
+		{target: "/posts", statusCode: http.StatusNoContent, allow: "GET, POST, OPTIONS"},
+		{target: "/users/me/sessions", statusCode: http.StatusNoContent, allow: "GET, DELETE, OPTIONS"},
+		{target: "/unknown", statusCode: http.StatusNotFound},
+	}
+
+	for _, v := range samples {
+		rr := serve("OPTIONS", v.target, "", "")
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, rr.Header().Get("Allow"), v.allow)
+		assert.Equal(t, rr.Header().Get("X-Content-Type-Options"), "nosniff")
+	}
+}
+
+func TestContractNotFound(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+
+	samples := []struct {
+		target       string
+		errorMessage string
+	}{
+		{target: "/unknown", errorMessage: "Not Found"},
+		{target: "/posts/42", errorMessage: "Post not found"},
+		{target: "/users/42", errorMessage: "User not found"},
+	}
+
+	for _, v := range samples {
+		rr := serve("GET", v.target, "", "")
+
+		assert.Equal(t, rr.Code, http.StatusNotFound)
+		assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+		responseMap := make(map[string]interface{})
+		err := json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, responseMap["error"], v.errorMessage)
+	}
+}
+
+func TestContractCreatedLocation(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	base := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+
+	rr := serve("POST", "/users", `{"nickname":"Pet", "email": "pet@gmail.com", "password": "password"}`, "")
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	user := struct {
+		ID uint32 `json:"id"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &user)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, rr.Header().Get("Location"), fmt.Sprintf("%s/users/%d", base, user.ID))
+
+	token, err := server.SignIn("pet@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	rr = serve("POST", "/posts", `{"title": "Title", "content": "Content"}`, "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	post := struct {
+		ID uint64 `json:"id"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &post)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	location := rr.Header().Get("Location")
+	assert.Equal(t, location, fmt.Sprintf("%s/posts/%d", base, post.ID))
+
+	rr = serve("GET", strings.TrimPrefix(location, base), "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+}
+
+func TestContractOwnership(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+	otherPost := "/posts/" + strconv.Itoa(int(posts[1].ID))
+	otherUser := "/users/" + strconv.Itoa(int(users[1].ID))
+
+	samples := []struct {
+		method     string
+		target     string
+		tokenGiven string
+		statusCode int
+	}{
+		{method: "DELETE", target: otherPost, tokenGiven: "", statusCode: http.StatusUnauthorized},
+		{method: "DELETE", target: otherPost, tokenGiven: "Bearer invalid", statusCode: http.StatusUnauthorized},
+		{method: "DELETE", target: otherPost, tokenGiven: tokenString, statusCode: http.StatusForbidden},
+		{method: "DELETE", target: otherUser, tokenGiven: tokenString, statusCode: http.StatusForbidden},
+		{method: "DELETE", target: "/posts/42", tokenGiven: tokenString, statusCode: http.StatusNotFound},
+	}
+
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", v.tokenGiven)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
+
+func TestContractNoContent(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+
+	targets := []string{
+		"/posts/" + strconv.Itoa(int(posts[0].ID)),
+		"/users/" + strconv.Itoa(int(users[0].ID)),
+	}
+
+	for _, target := range targets {
+		rr := serve("DELETE", target, "", tokenString)
+
+		assert.Equal(t, rr.Code, http.StatusNoContent)
+		assert.Equal(t, rr.Body.Len(), 0)
+		assert.Equal(t, rr.Header().Get("Content-Type"), "")
+		assert.Equal(t, rr.Header().Get("Entity"), "")
+	}
+}
@@ -1,6 +1,7 @@
 package controllertests
 
 import (
+	"github.com/Funskie/blogIris/api/auth"
 	"github.com/Funskie/blogIris/api/controllers"
 	"github.com/Funskie/blogIris/api/models"
 
@@ -55,15 +56,18 @@ func Database() {
 			fmt.Printf("We are connected to the %s database\n", TestDbDriver)
 		}
 	}
+
+	auth.Sessions = models.SessionStore{DB: server.DB}
+	server.SetupRouter()
 }
 
 func refreshUserTable() error {
-	err := server.DB.DropTableIfExists(&models.User{}).Error
+	err := server.DB.DropTableIfExists(&models.Mention{}, &models.NotificationPreference{}, &models.Notification{}, &models.ReadingListItem{}, &models.ReadingList{}, &models.Bookmark{}, &models.Follow{}, &models.Reaction{}, &models.Post{}, &models.User{}, &models.Session{}).Error
 	if err != nil {
 		return err
 	}
 
-	err = server.DB.AutoMigrate(&models.User{}).Error
+	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Session{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{}).Error
 	if err != nil {
 		return err
 	}
@@ -115,12 +119,27 @@ func seedUsers() ([]models.User, error) {
 }
 
 func refreshUserAndPostTable() error {
-	err := server.DB.DropTableIfExists(&models.Post{}, &models.User{}).Error
+	err := server.DB.DropTableIfExists(&models.Mention{}, &models.NotificationPreference{}, &models.Notification{}, &models.ReadingListItem{}, &models.ReadingList{}, &models.Bookmark{}, &models.Follow{}, &models.Reaction{}, &models.Post{}, &models.User{}, &models.Session{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Session{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{}).Error
+	if err != nil {
+		return err
+	}
+
+	log.Println("Successfully refreshed tables")
+	return nil
+}
+
+func refreshUserAndAuthTables() error {
+	err := server.DB.DropTableIfExists(&models.User{}, &models.Session{}, &models.Identity{}, &models.OneTimeToken{}).Error
 	if err != nil {
 		return err
 	}
 
-	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}).Error
+	err = server.DB.AutoMigrate(&models.User{}, &models.Session{}, &models.Identity{}, &models.OneTimeToken{}).Error
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,103 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestFollows(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, _, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+	me := "/users/" + strconv.Itoa(int(users[0].ID))
+	other := "/users/" + strconv.Itoa(int(users[1].ID))
+
+	samples := []struct {
+		method       string
+		target       string
+		token        string
+		statusCode   int
+		followers    int
+		errorMessage string
+	}{
+		{method: "POST", target: other + "/follow", token: tokenString, statusCode: 201, followers: 1},
+		{method: "POST", target: other + "/follow", token: tokenString, statusCode: 200, followers: 1},
+		{method: "POST", target: me + "/follow", token: tokenString, statusCode: 422, errorMessage: "Cannot Follow Yourself"},
+		{method: "POST", target: "/users/999/follow", token: tokenString, statusCode: 404, errorMessage: "User not found"},
+		{method: "POST", target: other + "/follow", token: "", statusCode: 401, errorMessage: "Missing credentials"},
+		{method: "DELETE", target: "/users/999/follow", token: tokenString, statusCode: 404, errorMessage: "Not following this user"},
+	}
+
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", v.token)
+		assert.Equal(t, rr.Code, v.statusCode)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+			continue
+		}
+		assert.Equal(t, responseMap["followers"], float64(v.followers))
+	}
+
+	list := func(target string) (int, followListResponse) {
+		rr := serve("GET", target, "", "")
+		list := followListResponse{}
+		if rr.Code == http.StatusOK {
+			err := json.Unmarshal(rr.Body.Bytes(), &list)
+			if err != nil {
+				t.Errorf("this is the error convert to json: %v", err)
+			}
+		}
+		return rr.Code, list
+	}
+
+	code, followers := list(other + "/followers")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, followers.Followers, 1)
+	assert.Equal(t, followers.Following, 0)
+	assert.Equal(t, len(followers.Users), 1)
+	assert.Equal(t, followers.Users[0].Nickname, users[0].Nickname)
+
+	code, following := list(me + "/following")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, following.Following, 1)
+	assert.Equal(t, following.Users[0].Nickname, users[1].Nickname)
+
+	code, _ = list("/users/999/followers")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	rr := serve("DELETE", other+"/follow", "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	_, followers = list(other + "/followers")
+	assert.Equal(t, followers.Followers, 0)
+	assert.Equal(t, len(followers.Users), 0)
+}
+
+type followListResponse struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+	Users     []struct {
+		Nickname string `json:"nickname"`
+	} `json:"users"`
+}
@@ -0,0 +1,75 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestHealthz(t *testing.T) {
+
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.Healthz)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+}
+
+func TestReadyz(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	err = refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+
+	samples := []struct {
+		drop       interface{}
+		statusCode int
+		migrations string
+	}{
+		{drop: nil, statusCode: 200, migrations: "ok"},
+		{drop: &models.Identity{}, statusCode: 503, migrations: "missing tables [identities]"},
+	}
+
+	for _, v := range samples {
+		if v.drop != nil {
+			err = server.DB.DropTableIfExists(v.drop).Error
+			if err != nil {
+				t.Errorf("this is the error dropping the table: %v", err)
+			}
+		}
+
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.Readyz)
+		handler.ServeHTTP(rr, req)
+
+		responseMap := struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}{}
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("Cannot convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, responseMap.Checks["database"], "ok")
+		assert.Equal(t, responseMap.Checks["migrations"], v.migrations)
+	}
+}
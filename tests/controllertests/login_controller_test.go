@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/go-playground/assert.v1"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -36,7 +40,7 @@ func TestSignIn(t *testing.T) {
 		{
 			email:        user.Email,
 			password:     "Wrong password",
-			errorMessage: "crypto/bcrypt: hashedPassword is not the hash of the given password",
+			errorMessage: "hashedPassword is not the hash of the given password",
 		},
 		{
 			email:        "Wrong email",
@@ -113,6 +117,7 @@ func TestLogin(t *testing.T) {
 		if err != nil {
 			t.Errorf("this is the error: %v", err)
 		}
+		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(server.Login)
 		handler.ServeHTTP(rr, req)
@@ -120,6 +125,18 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, rr.Code, v.statusCode)
 		if v.statusCode == 200 {
 			assert.NotEqual(t, rr.Body.String(), "")
+
+			// Browsers get the token in a cookie scripts cannot read.
+			cookies := map[string]*http.Cookie{}
+			for _, c := range rr.Result().Cookies() {
+				cookies[c.Name] = c
+			}
+			token := cookies[auth.TokenCookie]
+			assert.NotEqual(t, token, nil)
+			assert.Equal(t, token.HttpOnly, true)
+			assert.Equal(t, token.Secure, true)
+			assert.Equal(t, token.SameSite, http.SameSiteLaxMode)
+			assert.Equal(t, cookies[auth.CSRFCookie].Value, rr.Header().Get(auth.CSRFHeader))
 		}
 
 		if v.statusCode == 422 && v.errorMessage != "" {
@@ -132,3 +149,46 @@ func TestLogin(t *testing.T) {
 		}
 	}
 }
+
+func TestSignInRehashesLegacyPassword(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatalf("Error hashing password %v\n", err)
+	}
+	err = server.DB.Model(&user).UpdateColumn("password", string(legacy)).Error
+	if err != nil {
+		log.Fatalf("Error storing legacy hash %v\n", err)
+	}
+
+	_, err = server.SignIn(user.Email, "wrong password")
+	assert.Equal(t, err, errors.New("hashedPassword is not the hash of the given password"))
+
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		t.Errorf("this is the error signing in: %v", err)
+	}
+	assert.NotEqual(t, token, "")
+
+	userFound := models.User{}
+	_, err = userFound.FindUserByID(server.DB, user.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the user: %v", err)
+	}
+	assert.Equal(t, strings.HasPrefix(userFound.Password, "$argon2id$"), true)
+
+	_, err = server.SignIn(user.Email, "password")
+	if err != nil {
+		t.Errorf("this is the error signing in with the new hash: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// captureMailer collects the mail sent in the background.
+type captureMailer struct {
+	sent chan sentMail
+}
+
+func newCaptureMailer() *captureMailer {
+	return &captureMailer{sent: make(chan sentMail, 16)}
+}
+
+func (m *captureMailer) Send(to, subject, body string) error {
+	m.sent <- sentMail{to, subject, body}
+	return nil
+}
+
+// next waits for the next mail.
+func (m *captureMailer) next(t *testing.T) sentMail {
+	select {
+	case mail := <-m.sent:
+		return mail
+	case <-time.After(time.Second):
+		t.Fatalf("no mail was sent")
+		return sentMail{}
+	}
+}
+
+// none checks that no more mail is sent.
+func (m *captureMailer) none(t *testing.T) {
+	select {
+	case mail := <-m.sent:
+		t.Errorf("unexpected mail to %s", mail.to)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+var magicLinkPattern = regexp.MustCompile(`/login/magic/verify\?\S+`)
+
+func requestMagicLink(t *testing.T, email string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/login/magic", bytes.NewBufferString(`{"email": "`+email+`"}`))
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.RequestMagicLink).ServeHTTP(rr, req)
+	return rr
+}
+
+func verifyMagicLink(t *testing.T, link string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.VerifyMagicLink).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	mailer := newCaptureMailer()
+	server.Mailer = mailer
+
+	rr := requestMagicLink(t, user.Email)
+	assert.Equal(t, rr.Code, http.StatusAccepted)
+	mail := mailer.next(t)
+	assert.Equal(t, mail.to, user.Email)
+
+	link := magicLinkPattern.FindString(mail.body)
+	cookies := rr.Result().Cookies()
+
+	// opened in a browser without the requesting device cookie
+	rr = verifyMagicLink(t, link, nil)
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+
+	// the failed attempt used the link up
+	rr = verifyMagicLink(t, link, cookies)
+	assert.Equal(t, rr.Code, http.StatusGone)
+
+	rr = requestMagicLink(t, user.Email)
+	link = magicLinkPattern.FindString(mailer.next(t).body)
+	cookies = rr.Result().Cookies()
+
+	rr = verifyMagicLink(t, link, cookies)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var token string
+	err = json.Unmarshal(rr.Body.Bytes(), &token)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.NotEqual(t, token, "")
+
+	responseMap := make(map[string]interface{})
+	rr = verifyMagicLink(t, link, cookies)
+	json.Unmarshal(rr.Body.Bytes(), &responseMap)
+	assert.Equal(t, rr.Code, http.StatusGone)
+	assert.Equal(t, responseMap["error"], "Link Already Used")
+
+	tampered := regexp.MustCompile(`sig=[^&]+`).ReplaceAllString(link, "sig=forged")
+	rr = verifyMagicLink(t, tampered, cookies)
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	os.Setenv("MAGIC_LINK_MAX_PER_HOUR", "2")
+	defer os.Unsetenv("MAGIC_LINK_MAX_PER_HOUR")
+	mailer := newCaptureMailer()
+	server.Mailer = mailer
+
+	// Unknown emails get the same answers, and emails are counted whatever
+	// their case.
+	samples := []struct {
+		email      string
+		statusCode int
+	}{
+		{email: user.Email, statusCode: 202},
+		{email: strings.ToUpper(user.Email), statusCode: 202},
+		{email: user.Email, statusCode: 429},
+		{email: "nobody@gmail.com", statusCode: 202},
+		{email: "Nobody@gmail.com", statusCode: 202},
+		{email: "nobody@gmail.com", statusCode: 429},
+		{email: "nobodygmail.com", statusCode: 422},
+	}
+
+	for _, v := range samples {
+		rr := requestMagicLink(t, v.email)
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 202 {
+			assert.Equal(t, len(rr.Result().Cookies()), 1)
+		}
+	}
+	mailer.next(t)
+	mailer.next(t)
+	mailer.none(t)
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(to, subject, body string) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestMagicLinkMailFailure(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+	server.Mailer = failingMailer{}
+
+	// Failing to mail a registered email looks like mailing nobody.
+	for _, email := range []string{user.Email, "nobody@gmail.com"} {
+		rr := requestMagicLink(t, email)
+		assert.Equal(t, rr.Code, http.StatusAccepted)
+		assert.Equal(t, len(rr.Result().Cookies()), 1)
+	}
+}
@@ -0,0 +1,342 @@
+package controllertests
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/notify"
+)
+
+type notificationsResponse struct {
+	Notifications []struct {
+		ID      uint64 `json:"id"`
+		Type    string `json:"type"`
+		ActorID uint32 `json:"actor_id"`
+		Actor   struct {
+			Nickname string `json:"nickname"`
+		} `json:"actor"`
+		PostID *uint64 `json:"post_id"`
+		Detail string  `json:"detail"`
+		ReadAt *string `json:"read_at"`
+	} `json:"notifications"`
+	UnreadCount int    `json:"unread_count"`
+	NextCursor  string `json:"next_cursor"`
+}
+
+func getNotifications(t *testing.T, target, token string) (*notificationsResponse, int) {
+	rr := serve("GET", target, "", token)
+	page := &notificationsResponse{}
+	if rr.Code == http.StatusOK {
+		err := json.Unmarshal(rr.Body.Bytes(), page)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+	}
+	return page, rr.Code
+}
+
+func TestNotifications(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	author, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	reader, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	authorToken, readerToken := "Bearer "+author, "Bearer "+reader
+	post := "/posts/" + strconv.Itoa(int(posts[0].ID))
+
+	// The reader follows the author and reacts twice to their post, once
+	// again after taking the reaction back, and the author reacts to their
+	// own post.
+	actions := []struct {
+		method string
+		target string
+		token  string
+	}{
+		{method: "POST", target: "/users/" + strconv.Itoa(int(users[0].ID)) + "/follow", token: readerToken},
+		{method: "POST", target: post + "/reactions/like", token: readerToken},
+		{method: "DELETE", target: post + "/reactions/like", token: readerToken},
+		{method: "POST", target: post + "/reactions/like", token: readerToken},
+		{method: "POST", target: post + "/reactions/love", token: readerToken},
+		{method: "POST", target: post + "/reactions/like", token: authorToken},
+	}
+	for _, v := range actions {
+		rr := serve(v.method, v.target, "", v.token)
+		assert.Equal(t, rr.Code < 300, true)
+	}
+
+	page, code := getNotifications(t, "/notifications", authorToken)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, page.UnreadCount, 3)
+	assert.Equal(t, len(page.Notifications), 3)
+	assert.Equal(t, page.Notifications[0].Type, "reaction")
+	assert.Equal(t, page.Notifications[0].Detail, "love")
+	assert.Equal(t, *page.Notifications[0].PostID, posts[0].ID)
+	assert.Equal(t, page.Notifications[0].Actor.Nickname, users[1].Nickname)
+	assert.Equal(t, page.Notifications[1].Detail, "like")
+	assert.Equal(t, page.Notifications[2].Type, "follow")
+	assert.Equal(t, page.Notifications[2].ActorID, users[1].ID)
+
+	page, _ = getNotifications(t, "/notifications", readerToken)
+	assert.Equal(t, page.UnreadCount, 0)
+	assert.Equal(t, len(page.Notifications), 0)
+
+	// Pages
+	page, _ = getNotifications(t, "/notifications?limit=2", authorToken)
+	assert.Equal(t, len(page.Notifications), 2)
+	assert.Equal(t, page.NextCursor, strconv.FormatUint(page.Notifications[1].ID, 10))
+	page, _ = getNotifications(t, "/notifications?limit=2&cursor="+page.NextCursor, authorToken)
+	assert.Equal(t, len(page.Notifications), 1)
+	assert.Equal(t, page.Notifications[0].Type, "follow")
+	assert.Equal(t, page.NextCursor, "")
+	follow := page.Notifications[0].ID
+
+	samples := []struct {
+		method       string
+		target       string
+		token        string
+		statusCode   int
+		unreadCount  int
+		errorMessage string
+	}{
+		{method: "POST", target: "/notifications/" + strconv.FormatUint(follow, 10) + "/read", token: authorToken, statusCode: 200, unreadCount: 2},
+		{method: "POST", target: "/notifications/" + strconv.FormatUint(follow, 10) + "/read", token: authorToken, statusCode: 200, unreadCount: 2},
+		{method: "POST", target: "/notifications/" + strconv.FormatUint(follow, 10) + "/read", token: readerToken, statusCode: 404, errorMessage: "Notification not found"},
+		{method: "POST", target: "/notifications/999/read", token: authorToken, statusCode: 404, errorMessage: "Notification not found"},
+		{method: "POST", target: "/notifications/" + strconv.FormatUint(follow+1, 10) + "/read", token: "", statusCode: 401, errorMessage: "Missing credentials"},
+		{method: "POST", target: "/notifications/read-all?until=" + strconv.FormatUint(follow+1, 10), token: authorToken, statusCode: 200, unreadCount: 1},
+		{method: "POST", target: "/notifications/read-all", token: authorToken, statusCode: 200, unreadCount: 0},
+	}
+
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", v.token)
+		assert.Equal(t, rr.Code, v.statusCode)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+			continue
+		}
+		assert.Equal(t, responseMap["unread_count"], float64(v.unreadCount))
+	}
+
+	page, _ = getNotifications(t, "/notifications?unread=true", authorToken)
+	assert.Equal(t, len(page.Notifications), 0)
+	page, _ = getNotifications(t, "/notifications", authorToken)
+	assert.Equal(t, len(page.Notifications), 3)
+	assert.NotEqual(t, page.Notifications[0].ReadAt, nil)
+
+	_, code = getNotifications(t, "/notifications?limit=0", authorToken)
+	assert.Equal(t, code, http.StatusBadRequest)
+	_, code = getNotifications(t, "/notifications?cursor=x", authorToken)
+	assert.Equal(t, code, http.StatusBadRequest)
+	_, code = getNotifications(t, "/notifications", "")
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// A read reaction notifies again, an unread one does not.
+	serve("DELETE", post+"/reactions/love", "", readerToken)
+	serve("POST", post+"/reactions/love", "", readerToken)
+	page, _ = getNotifications(t, "/notifications", authorToken)
+	assert.Equal(t, page.UnreadCount, 1)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	author, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	reader, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	authorToken, readerToken := "Bearer "+author, "Bearer "+reader
+
+	samples := []struct {
+		body         string
+		statusCode   int
+		reaction     bool
+		follow       bool
+		errorMessage string
+	}{
+		{body: `{"reaction": false}`, statusCode: 200, reaction: false, follow: true},
+		{body: `{"reaction": false, "follow": true}`, statusCode: 200, reaction: false, follow: true},
+		{body: `{}`, statusCode: 200, reaction: false, follow: true},
+		{body: `{"comment": false, "reply": false}`, statusCode: 200, reaction: false, follow: true},
+		{body: `{"repost": false}`, statusCode: 422, errorMessage: "Unknown Notification Type"},
+		{body: `{"follow": "no"}`, statusCode: 422, errorMessage: "Field follow Must Be A Boolean"},
+	}
+
+	for _, v := range samples {
+		rr := serve("PATCH", "/notifications/preferences", v.body, authorToken)
+		assert.Equal(t, rr.Code, v.statusCode)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+			continue
+		}
+		assert.Equal(t, responseMap["reaction"], v.reaction)
+		assert.Equal(t, responseMap["follow"], v.follow)
+		assert.Equal(t, responseMap["mention"], true)
+	}
+
+	rr := serve("GET", "/notifications/preferences", "", readerToken)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"reaction":true`), true)
+
+	serve("POST", "/posts/"+strconv.Itoa(int(posts[0].ID))+"/reactions/like", "", readerToken)
+	serve("POST", "/users/"+strconv.Itoa(int(users[0].ID))+"/follow", "", readerToken)
+	page, _ := getNotifications(t, "/notifications", authorToken)
+	assert.Equal(t, len(page.Notifications), 1)
+	assert.Equal(t, page.Notifications[0].Type, "follow")
+}
+
+// readEvent reads the next event of a stream, skipping comments.
+func readEvent(t *testing.T, stream *bufio.Reader) map[string]string {
+	event := map[string]string{}
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("this is the error reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(event) > 0 {
+				return event
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		event[field] = value
+	}
+}
+
+func TestNotificationStream(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	author, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	reader, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	authorToken, readerToken := "Bearer "+author, "Bearer "+reader
+
+	server.Notifier = notify.NewMemory()
+	defer func() { server.Notifier = nil }()
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+
+	// A notification made before connecting is only sent to clients
+	// reconnecting from an earlier one.
+	serve("POST", "/users/"+strconv.Itoa(int(users[0].ID))+"/follow", "", readerToken)
+
+	open := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequest("GET", ts.URL+"/notifications/stream", nil)
+		if err != nil {
+			t.Fatalf("this is the error making the request: %v", err)
+		}
+		req.Header.Set("Authorization", authorToken)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("this is the error opening the stream: %v", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	resp, stream := open("")
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream")
+	event := readEvent(t, stream)
+	assert.Equal(t, event["event"], "unread")
+	assert.Equal(t, event["data"], `{"unread_count":1}`)
+
+	serve("POST", "/posts/"+strconv.Itoa(int(posts[0].ID))+"/reactions/wow", "", readerToken)
+	event = readEvent(t, stream)
+	assert.Equal(t, event["event"], "notification")
+	assert.Equal(t, strings.Contains(event["data"], `"detail":"wow"`), true)
+	reaction := event["id"]
+
+	serve("POST", "/notifications/read-all", "", authorToken)
+	event = readEvent(t, stream)
+	assert.Equal(t, event["event"], "unread")
+	assert.Equal(t, event["data"], `{"unread_count":0}`)
+	resp.Body.Close()
+
+	// Reconnecting from before the reaction replays it.
+	id, _ := strconv.ParseUint(reaction, 10, 64)
+	resp, stream = open(strconv.FormatUint(id-1, 10))
+	defer resp.Body.Close()
+	readEvent(t, stream)
+	event = readEvent(t, stream)
+	assert.Equal(t, event["id"], reaction)
+
+	rr := serve("GET", "/notifications/stream", "", "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+
+	// Logging out everywhere ends the stream at the next heartbeat.
+	os.Setenv("NOTIFY_HEARTBEAT", "50ms")
+	defer os.Unsetenv("NOTIFY_HEARTBEAT")
+	revoked, stream := open("")
+	defer revoked.Body.Close()
+	readEvent(t, stream)
+	rr = serve("DELETE", "/users/me/sessions", "", authorToken)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	_, err = io.ReadAll(stream)
+	assert.Equal(t, err, nil)
+}
@@ -0,0 +1,359 @@
+package controllertests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/models"
+)
+
+// mockOIDCProvider is a minimal local OpenID Connect provider. The
+// authorization endpoint logs in the configured identity immediately.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu       sync.Mutex
+	subject  string
+	email    string
+	verified bool
+	username string
+	codes    map[string]url.Values
+}
+
+func newMockOIDCProvider(clientID string) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("cannot generate key: %v", err)
+	}
+	m := &mockOIDCProvider{key: key, clientID: clientID, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		code, _ := auth.RandomString(16)
+		m.mu.Lock()
+		m.codes[code] = r.URL.Query()
+		m.mu.Unlock()
+		redirect := fmt.Sprintf("%s?code=%s&state=%s", r.URL.Query().Get("redirect_uri"), code, url.QueryEscape(r.URL.Query().Get("state")))
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		params, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		if !ok || auth.PKCEChallenge(r.Form.Get("code_verifier")) != params.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                m.URL,
+			"aud":                m.clientID,
+			"sub":                m.subject,
+			"email":              m.email,
+			"email_verified":     m.verified,
+			"preferred_username": m.username,
+			"nonce":              params.Get("nonce"),
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+		})
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockOIDCProvider) login(subject, email string, verified bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subject, m.email, m.verified = subject, email, verified
+}
+
+// named gives the next identities a preferred username.
+func (m *mockOIDCProvider) named(username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.username = username
+}
+
+// oidcLoginFlow logs in through the provider, finishing in another browser
+// than the one that started unless sameBrowser.
+func oidcLoginFlow(t *testing.T, provider string, sameBrowser bool) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/login/oidc/"+provider, nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"provider": provider})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.OIDCLogin).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusFound)
+	cookies := rr.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("cannot reach the authorization endpoint: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("cannot parse the callback: %v", err)
+	}
+
+	req, err = http.NewRequest("GET", "/login/oidc/"+provider+"/callback?"+callback.RawQuery, nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"provider": provider})
+	if sameBrowser {
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.OIDCCallback).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestOIDCLogin(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	idp := newMockOIDCProvider("blogiris")
+	defer idp.Close()
+	server.OIDCProviders = map[string]*auth.OIDCProvider{
+		"corp": {
+			Name:        "corp",
+			Issuer:      idp.URL,
+			ClientID:    "blogiris",
+			RedirectURL: "http://localhost:8080/login/oidc/corp/callback",
+		},
+	}
+
+	samples := []struct {
+		subject      string
+		email        string
+		verified     bool
+		otherBrowser bool
+		statusCode   int
+		userID       uint32
+	}{
+		{
+			// the login must finish in the browser that started it
+			subject:      "existing",
+			email:        user.Email,
+			verified:     true,
+			otherBrowser: true,
+			statusCode:   401,
+		},
+		{
+			// linked to the existing user by verified email
+			subject:    "existing",
+			email:      user.Email,
+			verified:   true,
+			statusCode: 200,
+			userID:     user.ID,
+		},
+		{
+			// the linked identity is found again on the next login
+			subject:    "existing",
+			email:      "changed@gmail.com",
+			verified:   false,
+			statusCode: 200,
+			userID:     user.ID,
+		},
+		{
+			// unverified emails are never linked or provisioned
+			subject:    "unverified",
+			email:      "someone@gmail.com",
+			verified:   false,
+			statusCode: 403,
+		},
+		{
+			// provisioned just in time
+			subject:    "new",
+			email:      "new@gmail.com",
+			verified:   true,
+			statusCode: 200,
+		},
+	}
+
+	for _, v := range samples {
+
+		idp.login(v.subject, v.email, v.verified)
+		rr := oidcLoginFlow(t, "corp", !v.otherBrowser)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode != 200 {
+			continue
+		}
+
+		var token string
+		err = json.Unmarshal(rr.Body.Bytes(), &token)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		uid, err := auth.ExtractTokenID(req)
+		if err != nil {
+			t.Errorf("this is the error extracting the token: %v", err)
+		}
+		if v.userID != 0 {
+			assert.Equal(t, uid, v.userID)
+		} else {
+			provisioned := models.User{}
+			_, err = provisioned.FindUserByID(server.DB, uid)
+			if err != nil {
+				t.Errorf("this is the error getting the user: %v", err)
+			}
+			assert.Equal(t, provisioned.Email, v.email)
+		}
+	}
+}
+
+func TestOIDCProvisionedNicknames(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	os.Setenv("BANNED_NICKNAMES", "admin")
+	defer func() {
+		os.Unsetenv("BANNED_NICKNAMES")
+		auth.LoadPasswordPolicy()
+	}()
+	err = auth.LoadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading the policy %v\n", err)
+	}
+
+	idp := newMockOIDCProvider("blogiris")
+	defer idp.Close()
+	server.OIDCProviders = map[string]*auth.OIDCProvider{
+		"corp": {
+			Name:        "corp",
+			Issuer:      idp.URL,
+			ClientID:    "blogiris",
+			RedirectURL: "http://localhost:8080/login/oidc/corp/callback",
+		},
+	}
+
+	samples := []struct {
+		username string
+		email    string
+		nickname string
+	}{
+		{username: " Jean Luc Picard ", email: "jl@gmail.com", nickname: "JeanLucPicard"},
+		{username: "Jean Luc Picard", email: "jl2@gmail.com", nickname: "JeanLucPicard2"},
+		{username: strings.Repeat("a", 40), email: "long@gmail.com", nickname: strings.Repeat("a", 32)},
+		{username: "...", email: "dots@gmail.com", nickname: "dots"},
+		{username: "ADMIN", email: "admin@gmail.com", nickname: "user_"},
+	}
+
+	for i, v := range samples {
+		idp.login("subject"+strconv.Itoa(i), v.email, true)
+		idp.named(v.username)
+		rr := oidcLoginFlow(t, "corp", true)
+		assert.Equal(t, rr.Code, http.StatusOK)
+
+		user := models.User{}
+		_, err = user.FindUserByEmail(server.DB, v.email)
+		if err != nil {
+			t.Errorf("this is the error getting the user: %v", err)
+			continue
+		}
+		if v.nickname == "user_" {
+			assert.Equal(t, strings.HasPrefix(user.Nickname, "user_"), true)
+			continue
+		}
+		assert.Equal(t, user.Nickname, v.nickname)
+	}
+}
+
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+
+	err := refreshUserAndAuthTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+
+	raw, _, err := models.IssueOneTimeToken(server.DB, "oidc_state", "corp", `{"provider":"corp"}`, time.Minute)
+	if err != nil {
+		log.Fatalf("Error issuing state %v\n", err)
+	}
+	_, err = models.ConsumeOneTimeToken(server.DB, "oidc_state", raw)
+	if err != nil {
+		log.Fatalf("Error consuming state %v\n", err)
+	}
+
+	server.OIDCProviders = map[string]*auth.OIDCProvider{"corp": {Name: "corp"}}
+	req, err := http.NewRequest("GET", "/login/oidc/corp/callback?code=abc&state="+raw, nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"provider": "corp"})
+	req.AddCookie(&http.Cookie{Name: "oidc_state", Value: models.HashToken(raw)})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.OIDCCallback).ServeHTTP(rr, req)
+
+	responseMap := make(map[string]interface{})
+	err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	assert.Equal(t, responseMap["error"], "Invalid State")
+}
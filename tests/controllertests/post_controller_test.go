@@ -1,18 +1,23 @@
 package controllertests
 
 import (
+	"github.com/Funskie/blogIris/api/cache"
 	"github.com/Funskie/blogIris/api/models"
 
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 	"gopkg.in/go-playground/assert.v1"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreatePost(t *testing.T) {
@@ -43,7 +48,7 @@ func TestCreatePost(t *testing.T) {
 		errorMessage string
 	}{
 		{
-			inputJSON:    `{"title": "Test create title", "content": "Test create content", "author_id": 1}`,
+			inputJSON:    `{"title": "Test create title", "content": "Test create content"}`,
 			statusCode:   201,
 			title:        "Test create title",
 			content:      "Test create content",
@@ -52,47 +57,41 @@ func TestCreatePost(t *testing.T) {
 			errorMessage: "",
 		},
 		{
-			inputJSON:    `{"title": "Test create title", "content": "Test create content", "author_id": 1}`,
+			inputJSON:    `{"title": "Test create title", "content": "Test create content"}`,
 			statusCode:   500,
 			tokenGiven:   tokenString,
 			errorMessage: "Title Already Taken",
 		},
 		{
-			inputJSON:    `{"title": "", "content": "Test create content", "author_id": 1}`,
+			inputJSON:    `{"title": "", "content": "Test create content"}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Title",
 		},
 		{
-			inputJSON:    `{"title": "Test create title 2", "content": "", "author_id": 1}`,
+			inputJSON:    `{"title": "Test create title 2", "content": ""}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Content",
 		},
 		{
-			inputJSON:    `{"title": "Test create title 2", "content": "Test create content"}`,
+			inputJSON:    `{"title": "Test create title 2", "content": "Test create content", "author_id": 5}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
-			errorMessage: "Required Author",
+			errorMessage: "Unknown Field author_id",
 		},
 		{
-			inputJSON:    `{"title": "Test create title 2", "content": "Test create content", "author_id": 1}`,
+			inputJSON:    `{"title": "Test create title 2", "content": "Test create content"}`,
 			statusCode:   401,
 			tokenGiven:   "",
 			errorMessage: "Unauthorized",
 		},
 		{
-			inputJSON:    `{"title": "Test create title 2", "content": "Test create content", "author_id": 1}`,
+			inputJSON:    `{"title": "Test create title 2", "content": "Test create content"}`,
 			statusCode:   401,
 			tokenGiven:   "This is incorrect token",
 			errorMessage: "Unauthorized",
 		},
-		{
-			inputJSON:    `{"title": "Test create title 2", "content": "Test create content", "author_id": 5}`,
-			statusCode:   401,
-			tokenGiven:   tokenString,
-			errorMessage: "Unauthorized",
-		},
 	}
 
 	for _, v := range samples {
@@ -101,6 +100,7 @@ func TestCreatePost(t *testing.T) {
 		if err != nil {
 			t.Errorf("this is the error: %v\n", err)
 		}
+		req.Header.Set("Content-Type", "application/json")
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(server.CreatePost)
@@ -119,7 +119,7 @@ func TestCreatePost(t *testing.T) {
 			assert.Equal(t, responseMap["content"], v.content)
 			assert.Equal(t, responseMap["author_id"], float64(v.authorID))
 		}
-		if v.statusCode == 401 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
+		if v.statusCode == 401 || v.statusCode == 403 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
 			assert.Equal(t, responseMap["error"], v.errorMessage)
 		}
 	}
@@ -187,6 +187,11 @@ func TestGetPostByID(t *testing.T) {
 			id:         "unknown",
 			statusCode: 400,
 		},
+		{
+			id:           strconv.Itoa(int(post.ID + 1)),
+			statusCode:   404,
+			errorMessage: "Post not found",
+		},
 	}
 
 	for _, v := range samples {
@@ -213,6 +218,9 @@ func TestGetPostByID(t *testing.T) {
 			assert.Equal(t, responseMap["content"], post.Content)
 			assert.Equal(t, responseMap["author_id"], float64(post.AuthorID))
 		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
 	}
 }
 
@@ -246,7 +254,7 @@ func TestUpdatePost(t *testing.T) {
 	}{
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "Test update title", "content": "Test update content", "author_id": 1}`,
+			updateJSON:   `{"title": "Test update title", "content": "Test update content", "version": 1}`,
 			statusCode:   200,
 			title:        "Test update title",
 			content:      "Test update content",
@@ -256,21 +264,21 @@ func TestUpdatePost(t *testing.T) {
 		},
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "Title 2", "content": "Test update content", "author_id": 1}`,
+			updateJSON:   `{"title": "Title 2", "content": "Test update content", "version": 2}`,
 			statusCode:   500,
 			tokenGiven:   tokenString,
 			errorMessage: "Title Already Taken",
 		},
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "", "content": "Test update content", "author_id": 1}`,
+			updateJSON:   `{"title": "", "content": "Test update content"}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Title",
 		},
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "Test update title", "content": "", "author_id": 1}`,
+			updateJSON:   `{"title": "Test update title", "content": ""}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Content",
@@ -279,19 +287,12 @@ func TestUpdatePost(t *testing.T) {
 			id:           strconv.Itoa(int(posts[0].ID)),
 			updateJSON:   `{"title": "Test update title", "content": "Test update content"}`,
 			statusCode:   401,
-			tokenGiven:   tokenString,
-			errorMessage: "Unauthorized",
-		},
-		{
-			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "Test update title", "content": "Test update content", "author_id": 1}`,
-			statusCode:   401,
 			tokenGiven:   "",
 			errorMessage: "Unauthorized",
 		},
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
-			updateJSON:   `{"title": "Test update title", "content": "Test update content", "author_id": 1}`,
+			updateJSON:   `{"title": "Test update title", "content": "Test update content"}`,
 			statusCode:   401,
 			tokenGiven:   "This is incorrect token",
 			errorMessage: "Unauthorized",
@@ -299,9 +300,16 @@ func TestUpdatePost(t *testing.T) {
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
 			updateJSON:   `{"title": "Test update title", "content": "Test update content", "author_id": 2}`,
-			statusCode:   401,
+			statusCode:   422,
 			tokenGiven:   tokenString,
-			errorMessage: "Unauthorized",
+			errorMessage: "Unknown Field author_id",
+		},
+		{
+			id:           strconv.Itoa(int(posts[1].ID)),
+			updateJSON:   `{"title": "Test update title", "content": "Test update content", "version": 1}`,
+			statusCode:   403,
+			tokenGiven:   tokenString,
+			errorMessage: "Forbidden",
 		},
 		{
 			id:         "unknwon",
@@ -315,6 +323,7 @@ func TestUpdatePost(t *testing.T) {
 		if err != nil {
 			t.Errorf("this is the error: %v\n", err)
 		}
+		req.Header.Set("Content-Type", "application/json")
 		req = mux.SetURLVars(req, map[string]string{"id": v.id})
 
 		rr := httptest.NewRecorder()
@@ -334,7 +343,7 @@ func TestUpdatePost(t *testing.T) {
 			assert.Equal(t, responseMap["content"], v.content)
 			assert.Equal(t, responseMap["author_id"], float64(v.authorID))
 		}
-		if v.statusCode == 401 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
+		if v.statusCode == 401 || v.statusCode == 403 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
 			assert.Equal(t, responseMap["error"], v.errorMessage)
 		}
 	}
@@ -387,10 +396,10 @@ func TestDeletePost(t *testing.T) {
 		},
 		{
 			id:           strconv.Itoa(int(posts[1].ID)),
-			statusCode:   401,
+			statusCode:   403,
 			authorID:     users[1].ID,
 			tokenGiven:   tokenString,
-			errorMessage: "Unauthorized",
+			errorMessage: "Forbidden",
 		},
 		{
 			id:           strconv.Itoa(int(posts[0].ID)),
@@ -416,9 +425,9 @@ func TestDeletePost(t *testing.T) {
 
 		assert.Equal(t, rr.Code, v.statusCode)
 		if v.statusCode == 204 {
-			assert.Equal(t, rr.Body.String()[:1], "1")
+			assert.Equal(t, rr.Body.String(), "")
 		}
-		if v.statusCode == 401 || v.statusCode == 400 && v.errorMessage != "" {
+		if v.errorMessage != "" {
 			responseMap := make(map[string]interface{})
 			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
 			if err != nil {
@@ -428,3 +437,315 @@ func TestDeletePost(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPostConditional(t *testing.T) {
+
+	mr := miniredis.RunT(t)
+	server.Cache = cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer func() { server.Cache = nil }()
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	user, post, err := seedOneUserAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(post.ID))})
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.GetPost)
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("", "")
+	etag := first.Header().Get("ETag")
+	assert.Equal(t, first.Code, http.StatusOK)
+	assert.NotEqual(t, etag, "")
+	assert.NotEqual(t, first.Header().Get("Last-Modified"), "")
+
+	// The second response comes from the cache without touching the table.
+	err = server.DB.Model(&models.Post{}).Where("id = ?", post.ID).UpdateColumn("title", "Changed behind the cache").Error
+	if err != nil {
+		t.Errorf("this is the error updating the post: %v\n", err)
+	}
+
+	samples := []struct {
+		header     string
+		value      string
+		statusCode int
+	}{
+		{header: "If-None-Match", value: etag, statusCode: http.StatusNotModified},
+		{header: "If-None-Match", value: `"other", ` + etag, statusCode: http.StatusNotModified},
+		{header: "If-None-Match", value: `"other"`, statusCode: http.StatusOK},
+		{header: "If-Modified-Since", value: first.Header().Get("Last-Modified"), statusCode: http.StatusNotModified},
+		{header: "If-Modified-Since", value: "Mon, 02 Jan 2006 15:04:05 GMT", statusCode: http.StatusOK},
+	}
+	for _, v := range samples {
+		rr := get(v.header, v.value)
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, rr.Header().Get("ETag"), etag)
+		if v.statusCode == http.StatusOK {
+			assert.Equal(t, rr.Body.String(), first.Body.String())
+		}
+	}
+
+	// Updating through the API drops the cached response.
+	req, err := http.NewRequest("PUT", "/posts", bytes.NewBufferString(fmt.Sprintf(`{"title": "Updated title", "content": "Updated content", "version": 1}`)))
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(post.ID))})
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.UpdatePost).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	rr = get("If-None-Match", etag)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NotEqual(t, rr.Header().Get("ETag"), etag)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "Updated title"), true)
+}
+
+func TestGetPostsLastModified(t *testing.T) {
+
+	mr := miniredis.RunT(t)
+	server.Cache = cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer func() { server.Cache = nil }()
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	// The cached posts were last invalidated an hour ago.
+	invalidated := time.Now().Add(-time.Hour)
+	mr.Set("posts:version", strconv.FormatInt(invalidated.UnixNano(), 36)+".seed")
+
+	rr := serve("GET", "/posts", "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var listed []models.Post
+	err = json.Unmarshal(rr.Body.Bytes(), &listed)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, len(listed), 2)
+	assert.Equal(t, listed[0].ID, posts[1].ID)
+	lastModified := rr.Header().Get("Last-Modified")
+	assert.Equal(t, lastModified, invalidated.UTC().Format(http.TimeFormat))
+
+	// Deleting a post leaves the others as they were, the list changed
+	// anyway.
+	rr = serve("DELETE", "/posts/"+strconv.Itoa(int(posts[1].ID)), "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+
+	req := httptest.NewRequest("GET", "/posts", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NotEqual(t, rr.Header().Get("Last-Modified"), lastModified)
+}
+
+func TestUpdatePostConcurrency(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	user, post, err := seedOneUserAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	update := func(version string, ifMatch string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"title": "Edited title", "content": "Edited content"%s}`, version)
+		req, err := http.NewRequest("PUT", "/posts", bytes.NewBufferString(body))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(post.ID))})
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.UpdatePost).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := update("", "")
+	assert.Equal(t, rr.Code, http.StatusPreconditionRequired)
+
+	rr = update(`, "version": 1`, "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	firstETag := rr.Header().Get("ETag")
+	assert.NotEqual(t, firstETag, "")
+
+	samples := []struct {
+		version        string
+		ifMatch        string
+		statusCode     int
+		currentVersion float64
+	}{
+		{version: `, "version": 1`, statusCode: http.StatusConflict, currentVersion: 2},
+		{ifMatch: `"stale"`, statusCode: http.StatusPreconditionFailed, currentVersion: 2},
+		{ifMatch: firstETag, statusCode: http.StatusOK},
+		{ifMatch: firstETag, statusCode: http.StatusPreconditionFailed, currentVersion: 3},
+	}
+
+	for _, v := range samples {
+		rr := update(v.version, v.ifMatch)
+		assert.Equal(t, rr.Code, v.statusCode)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		if v.statusCode != http.StatusOK {
+			current, _ := responseMap["current"].(map[string]interface{})
+			assert.Equal(t, current["version"], v.currentVersion)
+			assert.NotEqual(t, rr.Header().Get("ETag"), "")
+		}
+	}
+}
+
+func TestUpdatePostWithReaderETag(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	user, post, err := seedOneUserAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+	target := "/posts/" + strconv.Itoa(int(post.ID))
+
+	// The author's own bookmark is in the body but not in the ETag.
+	rr := serve("PUT", "/users/me/bookmarks/"+strconv.Itoa(int(post.ID)), "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	rr = serve("GET", target, "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"bookmarked":true`), true)
+	etag := rr.Header().Get("ETag")
+	assert.NotEqual(t, etag, "")
+
+	// Private responses are not validated, the bookmark may have changed.
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Authorization", tokenString)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	req = httptest.NewRequest("PUT", target, bytes.NewBufferString(`{"title": "Edited title", "content": "Edited content"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", tokenString)
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "Edited title"), true)
+}
+
+func TestPostMentions(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Error seeding users %v\n", err)
+	}
+	for i, nickname := range []string{"funskie", "chiii"} {
+		err = server.DB.Model(&models.User{}).Where("id = ?", users[i].ID).UpdateColumn("nickname", nickname).Error
+		if err != nil {
+			log.Fatalf("Error renaming users %v\n", err)
+		}
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	mentioned, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString, mentionedToken := "Bearer "+token, "Bearer "+mentioned
+	link := `<a href="/users/` + strconv.Itoa(int(users[1].ID)) + `" class="mention" data-user-id="` + strconv.Itoa(int(users[1].ID)) + `">@Chiii</a>`
+
+	samples := []struct {
+		method        string
+		content       string
+		statusCode    int
+		contentHTML   string
+		notifications int
+	}{
+		{method: "POST", content: "Thanks @Chiii & @nobody, from @funskie", statusCode: 201, contentHTML: "Thanks " + link + " &amp; @nobody, from", notifications: 1},
+		{method: "PUT", content: "Thanks @Chiii again", statusCode: 200, contentHTML: "Thanks " + link + " again", notifications: 1},
+		{method: "PUT", content: "Nobody", statusCode: 200, contentHTML: "Nobody", notifications: 1},
+		{method: "PUT", content: "Thanks @Chiii once more", statusCode: 200, contentHTML: "Thanks " + link + " once more", notifications: 2},
+	}
+
+	target, version := "/posts", ""
+	for _, v := range samples {
+		body := `{"title": "Mentions", "content": "` + v.content + `"` + version + `}`
+		rr := serve(v.method, target, body, tokenString)
+		assert.Equal(t, rr.Code, v.statusCode)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, strings.HasPrefix(responseMap["content_html"].(string), v.contentHTML), true)
+		target = "/posts/" + strconv.Itoa(int(responseMap["id"].(float64)))
+		version = fmt.Sprintf(`, "version": %d`, int(responseMap["version"].(float64)))
+
+		page, _ := getNotifications(t, "/notifications", mentionedToken)
+		assert.Equal(t, len(page.Notifications), v.notifications)
+		assert.Equal(t, page.Notifications[0].Type, "mention")
+		assert.Equal(t, page.Notifications[0].ActorID, users[0].ID)
+		// Reading them lets a later mention notify again.
+		serve("POST", "/notifications/read-all", "", mentionedToken)
+	}
+
+	// The author mentioned themselves without being notified.
+	page, _ := getNotifications(t, "/notifications", tokenString)
+	assert.Equal(t, len(page.Notifications), 0)
+}
@@ -0,0 +1,188 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Funskie/blogIris/api/cache"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestReactions(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = "Bearer " + token
+	}
+	post := "/posts/" + strconv.Itoa(int(posts[0].ID))
+
+	samples := []struct {
+		method       string
+		target       string
+		token        string
+		statusCode   int
+		likes        float64
+		errorMessage string
+	}{
+		{method: "POST", target: post + "/reactions/like", token: tokens[0], statusCode: 201, likes: 1},
+		{method: "POST", target: post + "/reactions/like", token: tokens[0], statusCode: 200, likes: 1},
+		{method: "POST", target: post + "/reactions/like", token: tokens[1], statusCode: 201, likes: 2},
+		{method: "POST", target: post + "/reactions/love", token: tokens[1], statusCode: 201, likes: 2},
+		{method: "POST", target: post + "/reactions/shrug", token: tokens[0], statusCode: 400, errorMessage: "Unknown Reaction Kind"},
+		{method: "POST", target: "/posts/999/reactions/like", token: tokens[0], statusCode: 404, errorMessage: "Post not found"},
+		{method: "POST", target: post + "/reactions/like", token: "", statusCode: 401, errorMessage: "Missing credentials"},
+		{method: "DELETE", target: post + "/reactions/like", token: tokens[0], statusCode: 204},
+		{method: "DELETE", target: post + "/reactions/like", token: tokens[0], statusCode: 404, errorMessage: "Reaction not found"},
+	}
+
+	for _, v := range samples {
+		rr := serve(v.method, v.target, "", v.token)
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 204 {
+			continue
+		}
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+			continue
+		}
+		reactions := responseMap["reactions"].(map[string]interface{})
+		assert.Equal(t, reactions["like"], v.likes)
+	}
+
+	// The counts are embedded in the post and every kind is listed.
+	rr := serve("GET", post, "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	postFound := struct {
+		Reactions map[string]int `json:"reactions"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &postFound)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, postFound.Reactions, map[string]int{"like": 1, "love": 1, "laugh": 0, "wow": 0, "sad": 0, "celebrate": 0})
+
+	listReactions := func(query string) []map[string]interface{} {
+		rr := serve("GET", post+"/reactions"+query, "", "")
+		assert.Equal(t, rr.Code, http.StatusOK)
+		var reactions []map[string]interface{}
+		err := json.Unmarshal(rr.Body.Bytes(), &reactions)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		return reactions
+	}
+	reactions := listReactions("")
+	assert.Equal(t, len(reactions), 2)
+	for _, reaction := range reactions {
+		assert.Equal(t, reaction["user"].(map[string]interface{})["nickname"], users[1].Nickname)
+	}
+	assert.Equal(t, len(listReactions("?kind=love")), 1)
+
+	// Reactions of users in the trash are not counted.
+	rr = serve("DELETE", "/users/"+strconv.Itoa(int(users[1].ID)), "", tokens[1])
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	assert.Equal(t, len(listReactions("")), 0)
+
+	// Posts in the trash cannot be reacted to.
+	rr = serve("DELETE", post, "", tokens[0])
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	rr = serve("POST", post+"/reactions/like", "", tokens[0])
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	rr = serve("GET", post+"/reactions", "", "")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestReactionsKeepListsCached(t *testing.T) {
+
+	mr := miniredis.RunT(t)
+	server.Cache = cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer func() { server.Cache = nil }()
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	post := "/posts/" + strconv.Itoa(int(posts[0].ID))
+
+	list := serve("GET", "/posts", "", "")
+	assert.Equal(t, list.Code, http.StatusOK)
+	first := serve("GET", post, "", "")
+	assert.Equal(t, first.Code, http.StatusOK)
+	version, err := mr.Get("posts:version")
+	if err != nil {
+		t.Errorf("this is the error getting the version: %v", err)
+	}
+
+	rr := serve("POST", post+"/reactions/like", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	// The version stays, so the list is still answered from the cache.
+	got, err := mr.Get("posts:version")
+	if err != nil {
+		t.Errorf("this is the error getting the version: %v", err)
+	}
+	assert.Equal(t, got, version)
+	conditional := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	rr = conditional("/posts", list.Header().Get("ETag"))
+	assert.Equal(t, rr.Code, http.StatusNotModified)
+
+	// The post itself shows the new count.
+	rr = conditional(post, first.Header().Get("ETag"))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	postFound := struct {
+		Reactions map[string]int `json:"reactions"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &postFound)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, postFound.Reactions["like"], 1)
+
+	rr = serve("DELETE", post+"/reactions/like", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	rr = serve("GET", post, "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	err = json.Unmarshal(rr.Body.Bytes(), &postFound)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, postFound.Reactions["like"], 0)
+}
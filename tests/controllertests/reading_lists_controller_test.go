@@ -0,0 +1,137 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+type readingListResponse struct {
+	ID     uint64 `json:"id"`
+	Name   string `json:"name"`
+	Public bool   `json:"public"`
+	Posts  []struct {
+		ID uint64 `json:"id"`
+	} `json:"posts"`
+}
+
+func (l readingListResponse) postIDs() []uint64 {
+	ids := []uint64{}
+	for _, p := range l.Posts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestReadingLists(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	third := models.Post{Title: "Title 3", Content: "Hello world 3", AuthorID: users[1].ID}
+	err = server.DB.Create(&third).Error
+	if err != nil {
+		log.Fatalf("Error seeding posts %v\n", err)
+	}
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = "Bearer " + token
+	}
+
+	send := func(method, target, body, token string, statusCode int) readingListResponse {
+		rr := serve(method, target, body, token)
+		assert.Equal(t, rr.Code, statusCode)
+		list := readingListResponse{}
+		if rr.Code == http.StatusOK || rr.Code == http.StatusCreated {
+			err := json.Unmarshal(rr.Body.Bytes(), &list)
+			if err != nil {
+				t.Errorf("this is the error convert to json: %v", err)
+			}
+		}
+		return list
+	}
+
+	send("POST", "/users/me/lists", `{"name": ""}`, tokens[0], http.StatusUnprocessableEntity)
+	list := send("POST", "/users/me/lists", `{"name": "Weekend"}`, tokens[0], http.StatusCreated)
+	assert.Equal(t, list.Public, false)
+	mine := "/users/me/lists/" + strconv.FormatUint(list.ID, 10)
+	public := fmt.Sprintf("/users/%d/lists/%d", users[0].ID, list.ID)
+
+	// Posts go to the end unless placed.
+	add := func(pid uint64, position string, statusCode int) []uint64 {
+		return send("POST", mine+"/posts", fmt.Sprintf(`{"post_id": %d%s}`, pid, position), tokens[0], statusCode).postIDs()
+	}
+	assert.Equal(t, add(posts[0].ID, "", http.StatusCreated), []uint64{posts[0].ID})
+	assert.Equal(t, add(posts[1].ID, "", http.StatusCreated), []uint64{posts[0].ID, posts[1].ID})
+	assert.Equal(t, add(third.ID, `, "position": 0`, http.StatusCreated), []uint64{third.ID, posts[0].ID, posts[1].ID})
+	assert.Equal(t, add(third.ID, "", http.StatusOK), []uint64{third.ID, posts[0].ID, posts[1].ID})
+	add(999, "", http.StatusUnprocessableEntity)
+	add(posts[0].ID, `, "position": -1`, http.StatusUnprocessableEntity)
+
+	order := fmt.Sprintf(`{"post_ids": [%d, %d, %d]}`, posts[1].ID, third.ID, posts[0].ID)
+	reordered := send("PUT", mine+"/posts", order, tokens[0], http.StatusOK)
+	assert.Equal(t, reordered.postIDs(), []uint64{posts[1].ID, third.ID, posts[0].ID})
+	send("PUT", mine+"/posts", fmt.Sprintf(`{"post_ids": [%d, %d]}`, posts[1].ID, third.ID), tokens[0], http.StatusUnprocessableEntity)
+
+	rr := serve("DELETE", mine+"/posts/"+strconv.FormatUint(third.ID, 10), "", tokens[0])
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	assert.Equal(t, send("GET", mine, "", tokens[0], http.StatusOK).postIDs(), []uint64{posts[1].ID, posts[0].ID})
+
+	// Private lists are hidden from everyone else until made public.
+	send("GET", public, "", "", http.StatusNotFound)
+	send("GET", mine, "", tokens[1], http.StatusNotFound)
+	send("PATCH", mine, `{"public": true}`, tokens[1], http.StatusNotFound)
+	updated := send("PATCH", mine, `{"public": true}`, tokens[0], http.StatusOK)
+	assert.Equal(t, updated.Name, "Weekend")
+	assert.Equal(t, updated.Public, true)
+	assert.Equal(t, send("GET", public, "", "", http.StatusOK).postIDs(), []uint64{posts[1].ID, posts[0].ID})
+
+	rr = serve("GET", fmt.Sprintf("/users/%d/lists", users[0].ID), "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var lists []readingListResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &lists)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, len(lists), 1)
+
+	// Posts in the trash are left out.
+	rr = serve("DELETE", "/posts/"+strconv.FormatUint(posts[1].ID, 10), "", tokens[1])
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	assert.Equal(t, send("GET", public, "", "", http.StatusOK).postIDs(), []uint64{posts[0].ID})
+
+	// Lists of users in the trash are hidden until they are restored.
+	owner := models.User{}
+	_, err = owner.DeleteAUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v", err)
+	}
+	send("GET", public, "", "", http.StatusNotFound)
+	rr = serve("GET", fmt.Sprintf("/users/%d/lists", users[0].ID), "", "")
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	_, err = owner.RestoreUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error restoring the user: %v", err)
+	}
+	send("GET", public, "", "", http.StatusOK)
+
+	rr = serve("DELETE", mine, "", tokens[0])
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	send("GET", mine, "", tokens[0], http.StatusNotFound)
+}
@@ -0,0 +1,188 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func loginFrom(t *testing.T, userAgent string) string {
+	req, err := http.NewRequest("POST", "/login", bytes.NewBufferString(`{"email": "pet@gmail.com", "password": "password"}`))
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.RemoteAddr = "10.0.0.1:5555"
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.Login).ServeHTTP(rr, req)
+
+	var token string
+	err = json.Unmarshal(rr.Body.Bytes(), &token)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	return fmt.Sprintf("Bearer %v", token)
+}
+
+func listSessions(t *testing.T, tokenGiven string) (int, []models.Session) {
+	req, err := http.NewRequest("GET", "/users/me/sessions", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("Authorization", tokenGiven)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GetSessions).ServeHTTP(rr, req)
+
+	var sessions []models.Session
+	if rr.Code == http.StatusOK {
+		err = json.Unmarshal(rr.Body.Bytes(), &sessions)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+	}
+	return rr.Code, sessions
+}
+
+func TestGetSessions(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+	_, err = seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	laptop := loginFrom(t, "laptop")
+	loginFrom(t, "phone")
+
+	code, sessions := listSessions(t, laptop)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(sessions), 2)
+	for _, s := range sessions {
+		assert.Equal(t, s.Current, s.UserAgent == "laptop")
+		assert.Equal(t, s.IP, "10.0.0.1")
+	}
+
+	code, _ = listSessions(t, "This is incorrect token")
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// Long user agents are cut between characters.
+	long := loginFrom(t, strings.Repeat("é", 200))
+	code, sessions = listSessions(t, long)
+	assert.Equal(t, code, http.StatusOK)
+	for _, s := range sessions {
+		if s.Current {
+			assert.Equal(t, s.UserAgent, strings.Repeat("é", 127))
+		}
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+	_, err = seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	laptop := loginFrom(t, "laptop")
+	phone := loginFrom(t, "phone")
+
+	_, sessions := listSessions(t, laptop)
+	var phoneID uint64
+	for _, s := range sessions {
+		if !s.Current {
+			phoneID = s.ID
+		}
+	}
+
+	samples := []struct {
+		id         string
+		tokenGiven string
+		statusCode int
+	}{
+		{id: strconv.Itoa(int(phoneID)), tokenGiven: "", statusCode: 401},
+		{id: "unknown", tokenGiven: laptop, statusCode: 400},
+		{id: strconv.Itoa(int(phoneID)), tokenGiven: laptop, statusCode: 204},
+		{id: strconv.Itoa(int(phoneID)), tokenGiven: laptop, statusCode: 404},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("DELETE", "/users/me/sessions", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": v.id})
+		req.Header.Set("Authorization", v.tokenGiven)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.DeleteSession).ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+
+	code, _ := listSessions(t, phone)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code, sessions = listSessions(t, laptop)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(sessions), 1)
+
+	// log out everywhere
+	req, err := http.NewRequest("DELETE", "/users/me/sessions", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("Authorization", laptop)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.DeleteSessions).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+
+	code, _ = listSessions(t, laptop)
+	assert.Equal(t, code, http.StatusUnauthorized)
+}
+
+func TestPasswordChangeRevokesOtherSessions(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user %v\n", err)
+	}
+
+	laptop := loginFrom(t, "laptop")
+	phone := loginFrom(t, "phone")
+
+	req, err := http.NewRequest("POST", "/users/password", bytes.NewBufferString(`{"current_password": "password", "new_password": "new password"}`))
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(user.ID))})
+	req.Header.Set("Authorization", laptop)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.UpdatePassword).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+
+	code, _ := listSessions(t, phone)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code, _ = listSessions(t, laptop)
+	assert.Equal(t, code, http.StatusOK)
+}
@@ -0,0 +1,192 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+type timelineResponse struct {
+	Posts []struct {
+		ID       uint64 `json:"id"`
+		AuthorID uint32 `json:"author_id"`
+	} `json:"posts"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func getTimeline(t *testing.T, target, token string) (*timelineResponse, int) {
+	rr := serve("GET", target, "", token)
+	page := &timelineResponse{}
+	if rr.Code == http.StatusOK {
+		err := json.Unmarshal(rr.Body.Bytes(), page)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Header().Get("Cache-Control"), "no-store")
+	}
+	return page, rr.Code
+}
+
+func TestTimeline(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Error seeding users %v\n", err)
+	}
+	stranger := models.User{Nickname: "Stranger", Email: "stranger@gmail.com", Password: "password"}
+	err = server.DB.Create(&stranger).Error
+	if err != nil {
+		log.Fatalf("Error seeding users %v\n", err)
+	}
+
+	// Five posts of the followed author, one of the reader and one of a
+	// stranger, a minute apart.
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	authors := []uint32{users[1].ID, users[1].ID, users[0].ID, stranger.ID, users[1].ID, users[1].ID, users[1].ID}
+	for i, author := range authors {
+		post := models.Post{
+			Title:     fmt.Sprintf("Title %d", i),
+			Content:   "Content",
+			AuthorID:  author,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+		err = server.DB.Create(&post).Error
+		if err != nil {
+			log.Fatalf("Error seeding posts %v\n", err)
+		}
+	}
+
+	token, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := "Bearer " + token
+
+	rr := serve("POST", "/users/"+strconv.Itoa(int(users[1].ID))+"/follow", "", tokenString)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	// Three pages of at most two posts, newest first, with the reader's own
+	// and without the stranger's.
+	var seen []uint32
+	target := "/timeline?limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Errorf("the timeline has more than three pages")
+			break
+		}
+		page, code := getTimeline(t, target, tokenString)
+		assert.Equal(t, code, http.StatusOK)
+		for _, p := range page.Posts {
+			seen = append(seen, p.AuthorID)
+		}
+		target = ""
+		if page.NextCursor != "" {
+			target = "/timeline?limit=2&cursor=" + page.NextCursor
+		}
+	}
+	assert.Equal(t, seen, []uint32{users[1].ID, users[1].ID, users[1].ID, users[0].ID, users[1].ID, users[1].ID})
+
+	samples := []struct {
+		target     string
+		token      string
+		statusCode int
+	}{
+		{target: "/timeline", token: "", statusCode: http.StatusUnauthorized},
+		{target: "/timeline?limit=0", token: tokenString, statusCode: http.StatusBadRequest},
+		{target: "/timeline?limit=101", token: tokenString, statusCode: http.StatusBadRequest},
+		{target: "/timeline?cursor=nope", token: tokenString, statusCode: http.StatusBadRequest},
+	}
+	for _, v := range samples {
+		_, code := getTimeline(t, v.target, v.token)
+		assert.Equal(t, code, v.statusCode)
+	}
+}
+
+func TestTimelineLink(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	user, _, err := seedOneUserAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	rr := serve("POST", "/timeline/link?ttl=1000000h", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+
+	rr = serve("POST", "/timeline/link?ttl=24h", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	link := struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &link)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		t.Errorf("this is the error parsing the link: %v", err)
+	}
+
+	// The link opens the timeline without credentials, but nothing else.
+	page, code := getTimeline(t, u.RequestURI(), "")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(page.Posts), 1)
+
+	rr = serve("GET", "/users/me/sessions?"+u.RawQuery, "", "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+
+	query := u.Query()
+	query.Set("uid", "999")
+	_, code = getTimeline(t, "/timeline?"+query.Encode(), "")
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// The session that signed the link is listed until the link expires,
+	// and the link expires with it.
+	rr = serve("GET", "/users/me/sessions", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var sessions []models.Session
+	err = json.Unmarshal(rr.Body.Bytes(), &sessions)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].ExpiresAt.Equal(link.ExpiresAt), true)
+
+	expire := func(at time.Time) {
+		err := server.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).UpdateColumn("expires_at", at).Error
+		if err != nil {
+			t.Errorf("this is the error expiring the session: %v", err)
+		}
+	}
+	expire(time.Now().Add(-time.Minute))
+	_, code = getTimeline(t, u.RequestURI(), "")
+	assert.Equal(t, code, http.StatusUnauthorized)
+	expire(link.ExpiresAt)
+
+	// Logging out everywhere, as deleting the user does, revokes the link.
+	rr = serve("DELETE", "/users/me/sessions", "", "Bearer "+token)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+	_, code = getTimeline(t, u.RequestURI(), "")
+	assert.Equal(t, code, http.StatusUnauthorized)
+}
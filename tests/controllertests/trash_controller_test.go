@@ -0,0 +1,138 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestRestorePost(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	_, err = posts[0].DeleteAPost(server.DB, posts[0].ID, users[0].ID)
+	if err != nil {
+		log.Fatalf("Error deleting post %v\n", err)
+	}
+
+	owner, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	other, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	samples := []struct {
+		id           string
+		tokenGiven   string
+		statusCode   int
+		errorMessage string
+	}{
+		{id: strconv.Itoa(int(posts[0].ID)), tokenGiven: other, statusCode: 403, errorMessage: "Forbidden"},
+		{id: strconv.Itoa(int(posts[1].ID)), tokenGiven: owner, statusCode: 404, errorMessage: "Post not found in trash"},
+		{id: strconv.Itoa(int(posts[0].ID)), tokenGiven: owner, statusCode: 200},
+		{id: strconv.Itoa(int(posts[0].ID)), tokenGiven: owner, statusCode: 404, errorMessage: "Post not found in trash"},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/posts/"+v.id+"/restore", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": v.id})
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", v.tokenGiven))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.RestorePost)
+		handler.ServeHTTP(rr, req)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+		if err != nil {
+			t.Errorf("Cannot convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			assert.Equal(t, responseMap["id"], float64(posts[0].ID))
+		} else {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
+	}
+}
+
+func TestGetTrashedUsers(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, _, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+	admin := models.User{Nickname: "Admin", Email: "admin@gmail.com", Password: "password", Admin: true}
+	err = server.DB.Create(&admin).Error
+	if err != nil {
+		log.Fatalf("Error seeding admin %v\n", err)
+	}
+	_, err = userInstance.DeleteAUser(server.DB, users[1].ID)
+	if err != nil {
+		log.Fatalf("Error deleting user %v\n", err)
+	}
+
+	adminToken, err := server.SignIn(admin.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	userToken, err := server.SignIn(users[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	samples := []struct {
+		tokenGiven string
+		statusCode int
+		trashed    int
+	}{
+		{tokenGiven: userToken, statusCode: 403},
+		{tokenGiven: adminToken, statusCode: 200, trashed: 1},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/trash/users", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", v.tokenGiven))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.GetTrashedUsers)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			var trashed []models.User
+			err = json.Unmarshal([]byte(rr.Body.String()), &trashed)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, len(trashed), v.trashed)
+			assert.Equal(t, trashed[0].ID, users[1].ID)
+		}
+	}
+}
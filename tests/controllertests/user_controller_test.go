@@ -1,6 +1,7 @@
 package controllertests
 
 import (
+	"github.com/Funskie/blogIris/api/auth"
 	"github.com/Funskie/blogIris/api/models"
 
 	"bytes"
@@ -8,9 +9,11 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"gopkg.in/go-playground/assert.v1"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"testing"
 )
@@ -66,6 +69,11 @@ func TestCreateUser(t *testing.T) {
 			statusCode:   422,
 			errorMessage: "Required Password",
 		},
+		{
+			inputJSON:    `{"nickname":"Kan", "email": "kan@gmail.com", "password": "short"}`,
+			statusCode:   422,
+			errorMessage: "Password Must Be At Least 8 Characters",
+		},
 	}
 
 	for _, v := range samples {
@@ -74,6 +82,7 @@ func TestCreateUser(t *testing.T) {
 		if err != nil {
 			t.Errorf("this is the error: %v", err)
 		}
+		req.Header.Set("Content-Type", "application/json")
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(server.CreateUser)
@@ -89,6 +98,8 @@ func TestCreateUser(t *testing.T) {
 		if v.statusCode == 201 {
 			assert.Equal(t, responseMap["nickname"], v.nickname)
 			assert.Equal(t, responseMap["email"], v.email)
+			_, hasPassword := responseMap["password"]
+			assert.Equal(t, hasPassword, false)
 		}
 		if v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
 			assert.Equal(t, responseMap["error"], v.errorMessage)
@@ -156,6 +167,11 @@ func TestGetUserByID(t *testing.T) {
 			id:         "unknow",
 			statusCode: 400,
 		},
+		{
+			id:           strconv.Itoa(int(user.ID + 1)),
+			statusCode:   404,
+			errorMessage: "User not found",
+		},
 	}
 
 	for _, v := range samples {
@@ -181,6 +197,9 @@ func TestGetUserByID(t *testing.T) {
 			assert.Equal(t, responseMap["nickname"], v.nickname)
 			assert.Equal(t, responseMap["email"], v.email)
 		}
+		if v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
 	}
 }
 
@@ -225,7 +244,7 @@ func TestUpdateUser(t *testing.T) {
 	}{
 		{
 			id:             strconv.Itoa(int(authID)),
-			updateJSON:     `{"nickname":"Chi", "email": "chi57@gmail.com", "password": "password"}`,
+			updateJSON:     `{"nickname":"Chi", "email": "chi57@gmail.com", "version": 1}`,
 			statusCode:     200,
 			updateNickname: "Chi",
 			updateEmail:    "chi57@gmail.com",
@@ -234,60 +253,69 @@ func TestUpdateUser(t *testing.T) {
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "chi57gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"Chi", "email": "chi57gmail.com"}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Invalid Email",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"", "email": "chi57@gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"", "email": "chi57@gmail.com"}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Nickname",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "", "password": "password"}`,
+			updateJSON:   `{"nickname":"Chi", "email": ""}`,
 			statusCode:   422,
 			tokenGiven:   tokenString,
 			errorMessage: "Required Email",
 		},
 		{
-			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com", "password": ""}`,
-			statusCode:   422,
-			tokenGiven:   tokenString,
-			errorMessage: "Required Password",
+			id:             strconv.Itoa(int(authID)),
+			updateJSON:     `{"email": "chi58@gmail.com", "version": 2}`,
+			statusCode:     200,
+			updateNickname: "Chi",
+			updateEmail:    "chi58@gmail.com",
+			tokenGiven:     tokenString,
+			errorMessage:   "",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com"}`,
 			statusCode:   401,
 			tokenGiven:   "",
 			errorMessage: "Unauthorized",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com"}`,
 			statusCode:   401,
 			tokenGiven:   "This is error token",
 			errorMessage: "Unauthorized",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Funskie 2", "email": "chi57@gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"Funskie 2", "email": "chi57@gmail.com", "version": 3}`,
 			statusCode:   500,
 			tokenGiven:   tokenString,
 			errorMessage: "Nickname Already Taken",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
-			updateJSON:   `{"nickname":"Chi", "email": "chiii57@gmail.com", "password": "password"}`,
+			updateJSON:   `{"nickname":"Chi", "email": "chiii57@gmail.com", "version": 3}`,
 			statusCode:   500,
 			tokenGiven:   tokenString,
 			errorMessage: "Email Already Taken",
 		},
+		{
+			id:           strconv.Itoa(int(authID)),
+			updateJSON:   `{"nickname":"Chi", "password": "password", "version": 3}`,
+			statusCode:   422,
+			tokenGiven:   tokenString,
+			errorMessage: "Unknown Field password",
+		},
 		{
 			id:         "unknown",
 			tokenGiven: tokenString,
@@ -295,10 +323,10 @@ func TestUpdateUser(t *testing.T) {
 		},
 		{
 			id:           strconv.Itoa(int(2)),
-			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com", "password": "password"}`,
-			statusCode:   401,
+			updateJSON:   `{"nickname":"Chi", "email": "chi57@gmail.com"}`,
+			statusCode:   403,
 			tokenGiven:   tokenString,
-			errorMessage: "Unauthorized",
+			errorMessage: "Forbidden",
 		},
 	}
 
@@ -308,6 +336,7 @@ func TestUpdateUser(t *testing.T) {
 		if err != nil {
 			t.Errorf("this is the error: %v", err)
 		}
+		req.Header.Set("Content-Type", "application/json")
 		req = mux.SetURLVars(req, map[string]string{"id": v.id})
 
 		rr := httptest.NewRecorder()
@@ -326,12 +355,112 @@ func TestUpdateUser(t *testing.T) {
 			assert.Equal(t, responseMap["nickname"], v.updateNickname)
 			assert.Equal(t, responseMap["email"], v.updateEmail)
 		}
-		if v.statusCode == 401 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
+		if v.statusCode == 401 || v.statusCode == 403 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
 			assert.Equal(t, responseMap["error"], v.errorMessage)
 		}
 	}
 }
 
+func TestUpdatePassword(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Error seeding users %v\n", err)
+	}
+	user := users[0]
+
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := fmt.Sprintf("Bearer %v", token)
+
+	samples := []struct {
+		id           string
+		inputJSON    string
+		tokenGiven   string
+		statusCode   int
+		errorMessage string
+	}{
+		{
+			id:           strconv.Itoa(int(user.ID)),
+			inputJSON:    `{"current_password": "password", "new_password": "new password"}`,
+			tokenGiven:   "",
+			statusCode:   401,
+			errorMessage: "Unauthorized",
+		},
+		{
+			id:           strconv.Itoa(int(users[1].ID)),
+			inputJSON:    `{"current_password": "password", "new_password": "new password"}`,
+			tokenGiven:   tokenString,
+			statusCode:   403,
+			errorMessage: "Forbidden",
+		},
+		{
+			id:           strconv.Itoa(int(user.ID)),
+			inputJSON:    `{"new_password": "new password"}`,
+			tokenGiven:   tokenString,
+			statusCode:   422,
+			errorMessage: "Required Current Password",
+		},
+		{
+			id:           strconv.Itoa(int(user.ID)),
+			inputJSON:    `{"current_password": "password", "new_password": "short"}`,
+			tokenGiven:   tokenString,
+			statusCode:   422,
+			errorMessage: "Password Must Be At Least 8 Characters",
+		},
+		{
+			id:           strconv.Itoa(int(user.ID)),
+			inputJSON:    `{"current_password": "wrong password", "new_password": "new password"}`,
+			tokenGiven:   tokenString,
+			statusCode:   422,
+			errorMessage: "Incorrect Password",
+		},
+		{
+			id:         strconv.Itoa(int(user.ID)),
+			inputJSON:  `{"current_password": "password", "new_password": "new password"}`,
+			tokenGiven: tokenString,
+			statusCode: 204,
+		},
+	}
+
+	for _, v := range samples {
+
+		req, err := http.NewRequest("POST", "/users/password", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"id": v.id})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.UpdatePassword)
+		req.Header.Set("Authorization", v.tokenGiven)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.errorMessage != "" {
+			responseMap := make(map[string]interface{})
+			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+			if err != nil {
+				t.Errorf("this is the error convert to json: %v", err)
+			}
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
+	}
+
+	_, err = server.SignIn(user.Email, "password")
+	assert.NotEqual(t, err, nil)
+	_, err = server.SignIn(user.Email, "new password")
+	assert.Equal(t, err, nil)
+}
+
 func TestDeleteUser(t *testing.T) {
 
 	var authEmail, authPassword string
@@ -389,8 +518,8 @@ func TestDeleteUser(t *testing.T) {
 		{
 			id:           strconv.Itoa(int(2)),
 			tokenGiven:   tokenString,
-			statusCode:   401,
-			errorMessage: "Unauthorized",
+			statusCode:   403,
+			errorMessage: "Forbidden",
 		},
 		{
 			id:           strconv.Itoa(int(authID)),
@@ -415,10 +544,10 @@ func TestDeleteUser(t *testing.T) {
 
 		assert.Equal(t, rr.Code, v.statusCode)
 		if v.statusCode == 204 {
-			assert.Equal(t, rr.Body.String()[:1], "1")
+			assert.Equal(t, rr.Body.String(), "")
 		}
 
-		if v.statusCode == 401 && v.errorMessage != "" {
+		if (v.statusCode == 401 || v.statusCode == 403) && v.errorMessage != "" {
 			responseMap := make(map[string]interface{})
 			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
 			if err != nil {
@@ -428,3 +557,83 @@ func TestDeleteUser(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+
+	breached, err := ioutil.TempFile("", "breached")
+	if err != nil {
+		log.Fatalf("Error creating breached list %v\n", err)
+	}
+	defer os.Remove(breached.Name())
+	// "password123" in plain text and "qwertyuiop" as a SHA-1 digest
+	fmt.Fprintln(breached, "password123")
+	fmt.Fprintln(breached, "B0399D2029F64D445BD131FFAA399A42D2F8E7DC:3912816")
+	breached.Close()
+
+	os.Setenv("PASSWORD_BREACHED_FILE", breached.Name())
+	os.Setenv("BANNED_NICKNAMES", "admin, root")
+	defer func() {
+		os.Unsetenv("PASSWORD_BREACHED_FILE")
+		os.Unsetenv("BANNED_NICKNAMES")
+		auth.LoadPasswordPolicy()
+	}()
+	err = auth.LoadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy %v\n", err)
+	}
+
+	samples := []struct {
+		inputJSON    string
+		statusCode   int
+		errorMessage string
+	}{
+		{
+			inputJSON:    `{"nickname":"Pet", "email": "pet@gmail.com", "password": "password123"}`,
+			statusCode:   422,
+			errorMessage: "Password Found In A Data Breach",
+		},
+		{
+			inputJSON:    `{"nickname":"Pet", "email": "pet@gmail.com", "password": "qwertyuiop"}`,
+			statusCode:   422,
+			errorMessage: "Password Found In A Data Breach",
+		},
+		{
+			inputJSON:    `{"nickname":"Admin", "email": "pet@gmail.com", "password": "correct horse"}`,
+			statusCode:   422,
+			errorMessage: "Nickname Not Allowed",
+		},
+		{
+			inputJSON:  `{"nickname":"Pet", "email": "pet@gmail.com", "password": "correct horse battery staple, well beyond the seventy two bytes bcrypt would silently ignore"}`,
+			statusCode: 201,
+		},
+	}
+
+	for _, v := range samples {
+
+		req, err := http.NewRequest("POST", "/users", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.CreateUser)
+		handler.ServeHTTP(rr, req)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 422 {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package loggertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/logger"
+)
+
+func TestGormLogger(t *testing.T) {
+
+	samples := []struct {
+		logSQL   bool
+		duration time.Duration
+		logged   bool
+		level    string
+	}{
+		{logSQL: false, duration: time.Millisecond, logged: false},
+		{logSQL: true, duration: time.Millisecond, logged: true, level: "DEBUG"},
+		{logSQL: false, duration: time.Second, logged: true, level: "WARN"},
+	}
+
+	for _, v := range samples {
+		var out bytes.Buffer
+		g := &logger.GormLogger{
+			Logger:        logger.New(&out, slog.LevelDebug, "json"),
+			LogSQL:        v.logSQL,
+			SlowThreshold: 200 * time.Millisecond,
+		}
+
+		hash := "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA"
+		g.Print("sql", "models/User.go:10", v.duration, "UPDATE `users` SET `password` = ? WHERE id = ?", []interface{}{hash, 1}, int64(1))
+
+		assert.Equal(t, out.Len() > 0, v.logged)
+		if !v.logged {
+			continue
+		}
+		assert.Equal(t, strings.Contains(out.String(), hash), false)
+
+		entry := make(map[string]interface{})
+		err := json.Unmarshal(out.Bytes(), &entry)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, entry["level"], v.level)
+		assert.Equal(t, entry["params"], []interface{}{"[REDACTED]", float64(1)})
+	}
+}
@@ -0,0 +1,89 @@
+package middlewaretests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/metrics"
+	"github.com/Funskie/blogIris/api/middlewares"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	return rr.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+
+	router := mux.NewRouter()
+	router.Use(middlewares.SetMiddlewareMetrics)
+	private := router.NewRoute().Subrouter()
+	private.Use(middlewares.SetMiddlewareAuthentication)
+	private.HandleFunc("/metered/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	router.NotFoundHandler = middlewares.Chain(http.NotFoundHandler(), middlewares.SetMiddlewareMetrics)
+
+	for _, path := range []string{"/metered/1", "/metered/2", "/no/such/path"} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrapeMetrics(t)
+	samples := []string{
+		`http_requests_total{method="GET",route="/metered/{id}",status="401"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/metered/{id}"} 2`,
+		`auth_token_validation_failures_total{reason="missing"} 2`,
+	}
+	for _, v := range samples {
+		if !strings.Contains(body, v) {
+			t.Errorf("missing metric %s", v)
+		}
+	}
+}
+
+func TestMetricsBasicAuth(t *testing.T) {
+
+	os.Setenv("METRICS_USERNAME", "prometheus")
+	os.Setenv("METRICS_PASSWORD", "scrape")
+	defer os.Unsetenv("METRICS_USERNAME")
+	defer os.Unsetenv("METRICS_PASSWORD")
+
+	samples := []struct {
+		username   string
+		password   string
+		statusCode int
+	}{
+		{username: "prometheus", password: "scrape", statusCode: 200},
+		{username: "prometheus", password: "wrong", statusCode: 401},
+		{username: "", password: "", statusCode: 401},
+	}
+
+	handler := metrics.Handler()
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		if v.username != "" {
+			req.SetBasicAuth(v.username, v.password)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
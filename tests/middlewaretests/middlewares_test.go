@@ -0,0 +1,139 @@
+package middlewaretests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/joho/godotenv"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/logger"
+	"github.com/Funskie/blogIris/api/middlewares"
+)
+
+var accessLog bytes.Buffer
+
+func TestMain(m *testing.M) {
+
+	err := godotenv.Load(os.ExpandEnv("../../.env"))
+	if err != nil {
+		log.Fatalf("Error getting env %v\n", err)
+	}
+	slog.SetDefault(logger.New(&accessLog, slog.LevelInfo, "json"))
+
+	os.Exit(m.Run())
+}
+
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(middlewares.SetMiddlewareRequestID, middlewares.SetMiddlewareLogger, middlewares.SetMiddlewareRecovery)
+
+	private := router.NewRoute().Subrouter()
+	private.Use(middlewares.SetMiddlewareJSON, middlewares.SetMiddlewareAuthentication)
+	private.HandleFunc("/private/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, middlewares.GetRequestID(r.Context()))
+	}).Methods("GET")
+
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}).Methods("GET")
+	return router
+}
+
+func TestRequestID(t *testing.T) {
+
+	samples := []struct {
+		given     string
+		generated bool
+	}{
+		{given: "abc-123", generated: false},
+		{given: "", generated: true},
+		{given: "not a valid id\n", generated: true},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/panic", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.Header.Set("X-Request-ID", v.given)
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		id := rr.Header().Get("X-Request-ID")
+		assert.NotEqual(t, id, "")
+		assert.Equal(t, id != v.given, v.generated)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+
+	req, err := http.NewRequest("GET", "/panic", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, req)
+
+	problem := make(map[string]interface{})
+	err = json.Unmarshal(rr.Body.Bytes(), &problem)
+	if err != nil {
+		t.Errorf("this is the error convert to json: %v", err)
+	}
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/problem+json")
+	assert.Equal(t, problem["status"], float64(500))
+	assert.Equal(t, problem["request_id"], rr.Header().Get("X-Request-ID"))
+}
+
+func TestAccessLog(t *testing.T) {
+
+	token, err := auth.CreateToken(7, "test")
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+
+	samples := []struct {
+		tokenGiven string
+		statusCode int
+		userID     float64
+	}{
+		{tokenGiven: "Bearer " + token, statusCode: 200, userID: 7},
+		{tokenGiven: "", statusCode: 401},
+	}
+
+	for _, v := range samples {
+		accessLog.Reset()
+		req, err := http.NewRequest("GET", "/private/42", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.Header.Set("Authorization", v.tokenGiven)
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		entry := make(map[string]interface{})
+		err = json.Unmarshal(accessLog.Bytes(), &entry)
+		if err != nil {
+			t.Errorf("this is the error convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, entry["status"], float64(v.statusCode))
+		assert.Equal(t, entry["route"], "/private/{id}")
+		assert.Equal(t, entry["path"], "/private/42")
+		assert.Equal(t, entry["request_id"], rr.Header().Get("X-Request-ID"))
+		if v.userID != 0 {
+			assert.Equal(t, entry["user_id"], v.userID)
+			assert.Equal(t, rr.Body.String(), rr.Header().Get("X-Request-ID"))
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package middlewaretests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/middlewares"
+	"github.com/Funskie/blogIris/api/ratelimit"
+)
+
+func newLimiter(policies ...ratelimit.Policy) *middlewares.RateLimiter {
+	l := &middlewares.RateLimiter{
+		Store:    ratelimit.NewMemory(),
+		Policies: map[string]*ratelimit.Policy{},
+		APIKeys:  map[string]string{"secret": "partner"},
+	}
+	for i := range policies {
+		l.Policies[policies[i].Name] = &policies[i]
+	}
+	return l
+}
+
+func TestRateLimit(t *testing.T) {
+
+	l := newLimiter(ratelimit.Policy{Name: "login", Limit: 2, Period: time.Minute})
+	handler := l.Limit("login", middlewares.ByIP, func(w http.ResponseWriter, r *http.Request) {})
+
+	samples := []struct {
+		remoteAddr string
+		statusCode int
+		remaining  string
+		retryAfter string
+	}{
+		{remoteAddr: "1.2.3.4:1000", statusCode: 200, remaining: "1"},
+		{remoteAddr: "1.2.3.4:1001", statusCode: 200, remaining: "0"},
+		{remoteAddr: "1.2.3.4:1002", statusCode: 429, remaining: "0", retryAfter: "30"},
+		{remoteAddr: "5.6.7.8:1000", statusCode: 200, remaining: "1"},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/login", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.RemoteAddr = v.remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, rr.Header().Get("RateLimit-Limit"), "2")
+		assert.Equal(t, rr.Header().Get("RateLimit-Remaining"), v.remaining)
+		assert.Equal(t, rr.Header().Get("RateLimit-Policy"), "2;w=60")
+		assert.Equal(t, rr.Header().Get("Retry-After"), v.retryAfter)
+		if v.statusCode == 429 {
+			assert.Equal(t, rr.Header().Get("Content-Type"), "application/problem+json")
+			problem := make(map[string]interface{})
+			err = json.Unmarshal(rr.Body.Bytes(), &problem)
+			if err != nil {
+				t.Errorf("this is the error convert to json: %v", err)
+			}
+			assert.Equal(t, problem["status"], float64(429))
+			assert.Equal(t, problem["detail"], "Rate limit exceeded, retry in 30 seconds")
+		}
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+
+	l := newLimiter(ratelimit.Policy{Name: "default", Limit: 1, Period: time.Minute})
+	handler := l.Limit("default", middlewares.ByClient, func(w http.ResponseWriter, r *http.Request) {})
+
+	// Known API keys get a bucket of their own, unknown ones count against
+	// the IP like requests without a key.
+	samples := []struct {
+		apiKey     string
+		forwarded  string
+		statusCode int
+	}{
+		{apiKey: "", statusCode: 200},
+		{apiKey: "made up", statusCode: 429},
+		{apiKey: "secret", statusCode: 200},
+		{apiKey: "secret", statusCode: 429},
+		{forwarded: "9.9.9.9", statusCode: 429},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.RemoteAddr = "1.2.3.4:1000"
+		if v.apiKey != "" {
+			req.Header.Set(middlewares.APIKeyHeader, v.apiKey)
+		}
+		if v.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", v.forwarded)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+
+	// Behind a trusted proxy the address it appended is the client, and
+	// what the client sent before it is ignored.
+	l.TrustProxy = true
+	proxied := []struct {
+		forwarded  string
+		statusCode int
+	}{
+		{forwarded: "6.6.6.6, 9.9.9.9", statusCode: 200},
+		{forwarded: "7.7.7.7, 9.9.9.9", statusCode: 429},
+	}
+	for _, v := range proxied {
+		req, err := http.NewRequest("GET", "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.RemoteAddr = "10.0.0.1:1000"
+		req.Header.Set("X-Forwarded-For", v.forwarded)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
+
+func TestRateLimitNested(t *testing.T) {
+
+	l := newLimiter(
+		ratelimit.Policy{Name: "default", Limit: 100, Period: time.Minute},
+		ratelimit.Policy{Name: "signup", Limit: 5, Period: time.Hour},
+	)
+	handler := l.Middleware("default", middlewares.ByClient)(l.Limit("signup", middlewares.ByIP, func(w http.ResponseWriter, r *http.Request) {}))
+
+	req, err := http.NewRequest("POST", "/users", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.RemoteAddr = "1.2.3.4:1000"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// The stricter route policy is the one reported.
+	assert.Equal(t, rr.Code, 200)
+	assert.Equal(t, rr.Header().Get("RateLimit-Limit"), "5")
+	assert.Equal(t, rr.Header().Get("RateLimit-Remaining"), "4")
+	assert.Equal(t, rr.Header().Get("RateLimit-Policy"), "5;w=3600")
+
+	// Without a limiter requests go through untouched.
+	var none *middlewares.RateLimiter
+	rr = httptest.NewRecorder()
+	none.Limit("signup", middlewares.ByIP, func(w http.ResponseWriter, r *http.Request) {})(rr, req)
+	assert.Equal(t, rr.Code, 200)
+	assert.Equal(t, rr.Header().Get("RateLimit-Limit"), "")
+}
+
+type countingSessions struct {
+	lookups int
+}
+
+func (s *countingSessions) ValidateSession(jti string, userID uint32) error {
+	s.lookups++
+	return nil
+}
+
+func TestRateLimitByUser(t *testing.T) {
+
+	os.Setenv("API_SECRET", "ratelimit-secret")
+	defer os.Unsetenv("API_SECRET")
+	sessions := &countingSessions{}
+	auth.Sessions = sessions
+	defer func() { auth.Sessions = nil }()
+
+	l := newLimiter(ratelimit.Policy{Name: "default", Limit: 1, Period: time.Minute})
+	handler := l.Limit("default", middlewares.ByClient, func(w http.ResponseWriter, r *http.Request) {})
+	first, err := auth.CreateToken(1, "first")
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+	second, err := auth.CreateToken(2, "second")
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+
+	// Users are counted apart from their address, and invalid tokens count
+	// against the address.
+	samples := []struct {
+		token      string
+		statusCode int
+	}{
+		{token: first, statusCode: 200},
+		{token: first, statusCode: 429},
+		{token: second, statusCode: 200},
+		{token: "not a token", statusCode: 200},
+		{token: "not a token", statusCode: 429},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.RemoteAddr = "1.2.3.4:1000"
+		req.Header.Set("Authorization", "Bearer "+v.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+	assert.Equal(t, sessions.lookups, 0)
+}
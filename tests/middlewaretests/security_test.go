@@ -0,0 +1,155 @@
+package middlewaretests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/auth"
+	"github.com/Funskie/blogIris/api/middlewares"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+
+	handler := middlewares.SecurityHeaders()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	samples := []struct {
+		proto string
+		hsts  string
+	}{
+		{proto: "", hsts: ""},
+		{proto: "https", hsts: "max-age=31536000; includeSubDomains"},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		if v.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", v.proto)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Header().Get("Strict-Transport-Security"), v.hsts)
+		assert.Equal(t, rr.Header().Get("Content-Security-Policy"), "default-src 'none'; frame-ancestors 'none'")
+		assert.Equal(t, rr.Header().Get("X-Content-Type-Options"), "nosniff")
+		assert.Equal(t, rr.Header().Get("Referrer-Policy"), "no-referrer")
+	}
+}
+
+func TestCORS(t *testing.T) {
+
+	os.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	os.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	defer os.Unsetenv("CORS_ALLOWED_ORIGINS")
+	defer os.Unsetenv("CORS_ALLOW_CREDENTIALS")
+
+	cors, err := middlewares.NewCORS()
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(cors.Middleware)
+	router.HandleFunc("/posts", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET", "POST")
+	router.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cors.Preflight(w, r, []string{"GET", "POST", "OPTIONS"})
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	samples := []struct {
+		method      string
+		origin      string
+		allowOrigin string
+		allowMethod string
+	}{
+		{method: "GET", origin: "https://app.example.com", allowOrigin: "https://app.example.com"},
+		{method: "GET", origin: "https://evil.example.com", allowOrigin: ""},
+		{method: "OPTIONS", origin: "https://app.example.com", allowOrigin: "https://app.example.com", allowMethod: "GET, POST, OPTIONS"},
+		{method: "OPTIONS", origin: "https://evil.example.com", allowOrigin: "", allowMethod: ""},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest(v.method, "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		req.Header.Set("Origin", v.origin)
+		if v.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Header().Get("Access-Control-Allow-Origin"), v.allowOrigin)
+		assert.Equal(t, rr.Header().Get("Access-Control-Allow-Methods"), v.allowMethod)
+		if v.allowOrigin != "" {
+			assert.Equal(t, rr.Header().Get("Access-Control-Allow-Credentials"), "true")
+		}
+		if v.allowMethod != "" {
+			assert.Equal(t, rr.Header().Get("Access-Control-Max-Age"), "600")
+		}
+	}
+
+	os.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	_, err = middlewares.NewCORS()
+	assert.Equal(t, err.Error(), "CORS_ALLOWED_ORIGINS cannot be * with CORS_ALLOW_CREDENTIALS")
+}
+
+func TestCSRF(t *testing.T) {
+
+	os.Setenv("AUTH_COOKIE", "true")
+	defer os.Unsetenv("AUTH_COOKIE")
+
+	token, err := auth.CreateToken(1, "")
+	if err != nil {
+		t.Errorf("this is the error creating the token: %v", err)
+	}
+	csrf := auth.CSRFToken(token)
+	handler := middlewares.SetMiddlewareCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	samples := []struct {
+		method        string
+		cookie        string
+		csrfCookie    string
+		header        string
+		authorization string
+		statusCode    int
+	}{
+		{method: "GET", cookie: token, statusCode: 200},
+		{method: "POST", cookie: token, csrfCookie: csrf, header: csrf, statusCode: 200},
+		{method: "POST", cookie: token, csrfCookie: csrf, statusCode: 403},
+		{method: "DELETE", cookie: token, csrfCookie: "planted", header: "planted", statusCode: 403},
+		{method: "POST", cookie: "expired", statusCode: 200},
+		{method: "POST", cookie: token, authorization: "Bearer " + token, statusCode: 200},
+		{method: "POST", cookie: token, authorization: "junk", statusCode: 403},
+		{method: "POST", statusCode: 200},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest(v.method, "/posts", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		if v.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: auth.TokenCookie, Value: v.cookie})
+		}
+		if v.csrfCookie != "" {
+			req.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: v.csrfCookie})
+		}
+		if v.header != "" {
+			req.Header.Set(auth.CSRFHeader, v.header)
+		}
+		if v.authorization != "" {
+			req.Header.Set("Authorization", v.authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
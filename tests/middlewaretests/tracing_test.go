@@ -0,0 +1,68 @@
+package middlewaretests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/middlewares"
+	"github.com/Funskie/blogIris/api/tracing"
+)
+
+func TestTracing(t *testing.T) {
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer provider.Shutdown(context.Background())
+
+	// The downstream service only checks that the trace was propagated.
+	var downstreamParent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamParent = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+
+	router := mux.NewRouter()
+	router.Use(middlewares.SetMiddlewareTracing)
+	router.HandleFunc("/traced/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), "GET", downstream.URL, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+		}
+		client := &http.Client{Transport: tracing.Transport(nil)}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("this is the error: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}).Methods("GET")
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest("GET", "/traced/7", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v", err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 2)
+	client, server := spans[0], spans[1]
+	assert.Equal(t, server.Name, "GET /traced/{id}")
+	assert.Equal(t, server.SpanContext.TraceID().String(), traceID)
+	assert.Equal(t, server.Parent.SpanID().String(), "00f067aa0ba902b7")
+	assert.Equal(t, client.Name, "HTTP GET")
+	assert.Equal(t, client.Parent.SpanID(), server.SpanContext.SpanID())
+	assert.Equal(t, downstreamParent, "00-"+traceID+"-"+client.SpanContext.SpanID().String()+"-01")
+}
@@ -0,0 +1,78 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestSaveFollow(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Error seeding users %v\n", err)
+	}
+
+	samples := []struct {
+		follower uint32
+		followed uint32
+		created  bool
+		err      error
+	}{
+		{follower: users[0].ID, followed: users[1].ID, created: true},
+		{follower: users[0].ID, followed: users[1].ID, created: false},
+		{follower: users[1].ID, followed: users[0].ID, created: true},
+		{follower: users[0].ID, followed: users[0].ID, err: models.ErrFollowSelf},
+	}
+	for _, v := range samples {
+		follow := models.Follow{FollowerID: v.follower, FollowedID: v.followed}
+		created, err := follow.SaveFollow(server.DB)
+		assert.Equal(t, err, v.err)
+		assert.Equal(t, created, v.created)
+	}
+
+	counts, err := models.CountFollows(server.DB, users[1].ID)
+	if err != nil {
+		t.Errorf("this is the error counting follows: %v\n", err)
+	}
+	assert.Equal(t, counts, models.FollowCounts{UserID: users[1].ID, Followers: 1, Following: 1})
+
+	// Users in the trash are left out of the counts.
+	_, err = userInstance.DeleteAUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+	}
+	counts, err = models.CountFollows(server.DB, users[1].ID)
+	if err != nil {
+		t.Errorf("this is the error counting follows: %v\n", err)
+	}
+	assert.Equal(t, counts, models.FollowCounts{UserID: users[1].ID})
+}
+
+func TestTimelineCursor(t *testing.T) {
+
+	cursor := models.TimelineCursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: 42}
+	parsed, err := models.ParseTimelineCursor(cursor.String())
+	if err != nil {
+		t.Errorf("this is the error parsing the cursor: %v\n", err)
+		return
+	}
+	assert.Equal(t, parsed.ID, cursor.ID)
+	assert.Equal(t, parsed.CreatedAt.Equal(cursor.CreatedAt), true)
+
+	for _, s := range []string{"nope!", "bm9wZQ"} {
+		_, err = models.ParseTimelineCursor(s)
+		assert.Equal(t, err, models.ErrInvalidCursor)
+	}
+	parsed, err = models.ParseTimelineCursor("")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, parsed == nil, true)
+}
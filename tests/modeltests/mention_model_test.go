@@ -0,0 +1,106 @@
+package modeltests
+
+import (
+	"log"
+	"strconv"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestParseMentions(t *testing.T) {
+
+	samples := []struct {
+		content string
+		names   []string
+	}{
+		{content: "Thanks @alice and @Bob_2!", names: []string{"alice", "Bob_2"}},
+		{content: "@alice, @ALICE and @alice.", names: []string{"alice"}},
+		{content: "(@zoë) @jean-luc.picard.", names: []string{"zoë", "jean-luc.picard"}},
+		{content: "mail me at alice@example.com or @ alone", names: nil},
+		{content: "@@alice and x/@bob", names: nil},
+		{content: "no mentions", names: nil},
+	}
+
+	for _, v := range samples {
+		assert.Equal(t, models.ParseMentions(v.content), v.names)
+	}
+}
+
+func TestSaveMentions(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users := []models.User{
+		{Nickname: "alice", Email: "alice@gmail.com", Password: "password"},
+		{Nickname: "bob", Email: "bob@gmail.com", Password: "password"},
+		{Nickname: "carol", Email: "carol@gmail.com", Password: "password"},
+	}
+	for i := range users {
+		err = server.DB.Create(&users[i]).Error
+		if err != nil {
+			log.Fatalf("Error seeding users %v\n", err)
+		}
+	}
+	alice, bob, carol := users[0].ID, users[1].ID, users[2].ID
+	link := func(uid uint32, name string) string {
+		id := strconv.Itoa(int(uid))
+		return `<a href="/users/` + id + `" class="mention" data-user-id="` + id + `">@` + name + `</a>`
+	}
+
+	post := models.Post{Title: "Mentions", Content: "Hi @Bob and @nobody", AuthorID: alice}
+	_, err = post.SavePost(server.DB)
+	if err != nil {
+		log.Fatalf("Error saving the post %v\n", err)
+	}
+	assert.Equal(t, post.Mentioned, []uint32{bob})
+	assert.Equal(t, post.ContentHTML, "Hi "+link(bob, "Bob")+" and @nobody")
+
+	// Bob renames himself and carol takes his nickname, the post keeps
+	// referring to him.
+	err = server.DB.Model(&models.User{}).Where("id = ?", bob).UpdateColumn("nickname", "robert").Error
+	if err != nil {
+		t.Errorf("this is the error renaming the user: %v\n", err)
+	}
+	err = server.DB.Model(&models.User{}).Where("id = ?", carol).UpdateColumn("nickname", "bob").Error
+	if err != nil {
+		t.Errorf("this is the error renaming the user: %v\n", err)
+	}
+
+	samples := []struct {
+		content   string
+		mentioned []uint32
+		html      string
+	}{
+		{content: "Hi @bob and @alice", mentioned: []uint32{alice}, html: "Hi " + link(bob, "bob") + " and " + link(alice, "alice")},
+		{content: "Hi @robert", mentioned: nil, html: "Hi " + link(bob, "robert")},
+		{content: "Hi @bob", mentioned: []uint32{carol}, html: "Hi " + link(carol, "bob")},
+	}
+	for _, v := range samples {
+		update := models.Post{Title: post.Title, Content: v.content, AuthorID: alice, Version: post.Version}
+		_, err = update.UpdateAPost(server.DB, post.ID)
+		if err != nil {
+			t.Errorf("this is the error updating the post: %v\n", err)
+			return
+		}
+		post = update
+		assert.Equal(t, post.Mentioned, v.mentioned)
+		assert.Equal(t, post.ContentHTML, v.html)
+	}
+
+	// Mentions of users in the trash are plain text until they are restored.
+	_, err = userInstance.DeleteAUser(server.DB, carol)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+	}
+	found := models.Post{}
+	_, err = found.FindPostByID(server.DB, post.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the post: %v\n", err)
+	}
+	assert.Equal(t, found.ContentHTML, "Hi @bob")
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"github.com/jinzhu/gorm"
@@ -54,15 +55,28 @@ func Database() {
 			fmt.Printf("We are connected to the %s database\n", TestDbDriver)
 		}
 	}
+
+	server.DB.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.Scope) {
+		atomic.AddInt64(&queryCount, 1)
+	})
+}
+
+var queryCount int64
+
+// countQueries returns the number of select queries run by fn.
+func countQueries(fn func()) int64 {
+	before := atomic.LoadInt64(&queryCount)
+	fn()
+	return atomic.LoadInt64(&queryCount) - before
 }
 
 func refreshUserTable() error {
-	err := server.DB.DropTableIfExists(&models.User{}).Error
+	err := server.DB.DropTableIfExists(&models.Mention{}, &models.NotificationPreference{}, &models.Notification{}, &models.ReadingListItem{}, &models.ReadingList{}, &models.Bookmark{}, &models.Follow{}, &models.Reaction{}, &models.Post{}, &models.User{}).Error
 	if err != nil {
 		return err
 	}
 
-	err = server.DB.AutoMigrate(&models.User{}).Error
+	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{}).Error
 	if err != nil {
 		return err
 	}
@@ -114,12 +128,12 @@ func seedUsers() ([]models.User, error) {
 }
 
 func refreshUserAndPostTable() error {
-	err := server.DB.DropTableIfExists(&models.Post{}, &models.User{}).Error
+	err := server.DB.DropTableIfExists(&models.Mention{}, &models.NotificationPreference{}, &models.Notification{}, &models.ReadingListItem{}, &models.ReadingList{}, &models.Bookmark{}, &models.Follow{}, &models.Reaction{}, &models.Post{}, &models.User{}).Error
 	if err != nil {
 		return err
 	}
 
-	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}).Error
+	err = server.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Reaction{}, &models.Follow{}, &models.Bookmark{}, &models.ReadingList{}, &models.ReadingListItem{}, &models.Notification{}, &models.NotificationPreference{}, &models.Mention{}).Error
 	if err != nil {
 		return err
 	}
@@ -196,3 +210,44 @@ func seedUsersAndPosts() ([]models.User, []models.Post, error) {
 	}
 	return users, posts, nil
 }
+
+// seedManyMentioningPosts adds n posts of the users that mention the
+// reader, who likes each of them.
+func seedManyMentioningPosts(users []models.User, reader models.User, n int) error {
+	for i := 0; i < n; i++ {
+		post := models.Post{
+			Title:    fmt.Sprintf("Many mentioning posts title %d", i),
+			Content:  fmt.Sprintf("Many posts content %d for @%s", i, reader.Nickname),
+			AuthorID: users[i%len(users)].ID,
+		}
+		err := server.DB.Create(&post).Error
+		if err != nil {
+			return err
+		}
+		_, err = models.SaveMentions(server.DB, &post)
+		if err != nil {
+			return err
+		}
+		reaction := models.Reaction{PostID: post.ID, UserID: reader.ID, Kind: "like"}
+		_, err = reaction.SaveReaction(server.DB)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seedManyPosts(users []models.User, n int) error {
+	for i := 0; i < n; i++ {
+		post := models.Post{
+			Title:    fmt.Sprintf("Many posts title %d", i),
+			Content:  fmt.Sprintf("Many posts content %d", i),
+			AuthorID: users[i%len(users)].ID,
+		}
+		err := server.DB.Create(&post).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres driver
 	"gopkg.in/go-playground/assert.v1"
 	"log"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +30,8 @@ func TestFindAllPosts(t *testing.T) {
 	}
 
 	assert.Equal(t, len(*postsFound), 2)
+	// Latest first.
+	assert.Equal(t, (*postsFound)[0].ID > (*postsFound)[1].ID, true)
 }
 
 func TestSavePost(t *testing.T) {
@@ -103,6 +106,7 @@ func TestUpdatePost(t *testing.T) {
 		Title:    "Test update post title",
 		Content:  "new ttttttttttt",
 		AuthorID: post.AuthorID,
+		Version:  post.Version,
 	}
 
 	updatedPost, err := postUpdate.UpdateAPost(server.DB, postUpdate.ID)
@@ -117,6 +121,51 @@ func TestUpdatePost(t *testing.T) {
 	assert.Equal(t, updatedPost.AuthorID, postUpdate.AuthorID)
 }
 
+func TestUpdatePostVersionConflict(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+
+	_, post, err := seedOneUserAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding user and post table %v\n", err)
+	}
+	assert.Equal(t, post.Version, uint32(1))
+
+	// Both editors start from version 1, only the first one saves.
+	samples := []struct {
+		title   string
+		err     error
+		version uint32
+	}{
+		{title: "First editor title", err: nil, version: 2},
+		{title: "Second editor title", err: models.ErrVersionConflict},
+	}
+
+	for _, v := range samples {
+		postUpdate := models.Post{
+			Title:    v.title,
+			Content:  "edited content",
+			AuthorID: post.AuthorID,
+			Version:  post.Version,
+		}
+		updatedPost, err := postUpdate.UpdateAPost(server.DB, post.ID)
+		assert.Equal(t, err, v.err)
+		if v.err == nil {
+			assert.Equal(t, updatedPost.Version, v.version)
+		}
+	}
+
+	postFound, err := postInstance.FindPostByID(server.DB, post.ID)
+	if err != nil {
+		t.Errorf("this is the error getting post by ID %v\n", err)
+		return
+	}
+	assert.Equal(t, postFound.Title, "First editor title")
+}
+
 func TestDeletePost(t *testing.T) {
 
 	err := refreshUserAndPostTable()
@@ -137,3 +186,122 @@ func TestDeletePost(t *testing.T) {
 
 	assert.Equal(t, isDelete, int64(1))
 }
+
+func TestFindAllPostsQueryCount(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+
+	users, _, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	reader := models.User{
+		Nickname: "reader",
+		Email:    "reader@gmail.com",
+		Password: "password",
+	}
+	err = server.DB.Create(&reader).Error
+	if err != nil {
+		log.Fatalf("cannot seed reader: %v\n", err)
+	}
+
+	// The posts, their authors, reaction counts and mentions.
+	samples := []struct {
+		posts   int
+		queries int64
+	}{
+		{posts: 1, queries: 4},
+		{posts: 20, queries: 4},
+		{posts: 50, queries: 4},
+	}
+
+	for _, v := range samples {
+		err = seedManyMentioningPosts(users, reader, v.posts)
+		if err != nil {
+			log.Fatalf("Error seeding posts %v\n", err)
+		}
+
+		var postsFound *[]models.Post
+		queries := countQueries(func() {
+			postsFound, err = postInstance.FindAllPosts(server.DB)
+		})
+		if err != nil {
+			t.Errorf("this is the error getting posts %v\n", err)
+			return
+		}
+		assert.Equal(t, queries, v.queries)
+		for _, p := range *postsFound {
+			assert.Equal(t, p.Author.ID, p.AuthorID)
+			if strings.Contains(p.Content, "@") {
+				assert.Equal(t, p.Reactions["like"], 1)
+				assert.Equal(t, strings.Contains(p.ContentHTML, `class="mention"`), true)
+			}
+		}
+	}
+}
+
+func TestFindPostsFields(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+
+	_, _, err = seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+
+	fields, err := models.ParsePostFields("title,created_at")
+	if err != nil {
+		t.Errorf("this is the error parsing fields %v\n", err)
+		return
+	}
+	postsFound, err := postInstance.FindPosts(server.DB, fields)
+	if err != nil {
+		t.Errorf("this is the error getting posts %v\n", err)
+		return
+	}
+
+	assert.Equal(t, len(*postsFound), 2)
+	for _, p := range *postsFound {
+		assert.NotEqual(t, p.Title, "")
+		assert.Equal(t, p.Content, "")
+		assert.Equal(t, p.Author.ID, p.AuthorID)
+	}
+
+	_, err = models.ParsePostFields("title,password")
+	assert.Equal(t, err.Error(), "Unknown Field password")
+}
+
+// BenchmarkFindAllPosts reports the queries per listing, which stay the
+// same however many posts and authors there are.
+func BenchmarkFindAllPosts(b *testing.B) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, _, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+	err = seedManyPosts(users, 98)
+	if err != nil {
+		log.Fatalf("Error seeding posts %v\n", err)
+	}
+
+	b.ResetTimer()
+	queries := countQueries(func() {
+		for i := 0; i < b.N; i++ {
+			_, err := postInstance.FindAllPosts(server.DB)
+			if err != nil {
+				b.Fatalf("this is the error getting posts %v\n", err)
+			}
+		}
+	})
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+}
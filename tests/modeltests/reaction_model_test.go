@@ -0,0 +1,92 @@
+package modeltests
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestLoadReactionKinds(t *testing.T) {
+
+	defer os.Unsetenv("REACTION_KINDS")
+	defer models.LoadReactionKinds()
+
+	samples := []struct {
+		spec  string
+		kinds []string
+		err   bool
+	}{
+		{spec: "", kinds: []string{"like", "love", "laugh", "wow", "sad", "celebrate"}},
+		{spec: "Like:👍, fire:🔥", kinds: []string{"like", "fire"}},
+		{spec: "like", err: true},
+		{spec: "like:👍,like:❤️", err: true},
+		{spec: "thumbs up:👍", err: true},
+	}
+
+	for _, v := range samples {
+		os.Setenv("REACTION_KINDS", v.spec)
+		err := models.LoadReactionKinds()
+		assert.Equal(t, err != nil, v.err)
+		if v.err {
+			continue
+		}
+		names := []string{}
+		for _, k := range models.ReactionKinds {
+			names = append(names, k.Name)
+		}
+		assert.Equal(t, names, v.kinds)
+	}
+}
+
+func TestSaveReaction(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding users and posts %v\n", err)
+	}
+
+	samples := []struct {
+		userID  uint32
+		kind    string
+		created bool
+		err     error
+	}{
+		{userID: users[0].ID, kind: "like", created: true},
+		{userID: users[0].ID, kind: "like", created: false},
+		{userID: users[1].ID, kind: "like", created: true},
+		{userID: users[0].ID, kind: "wow", created: true},
+		{userID: users[0].ID, kind: "shrug", err: models.ErrUnknownReaction},
+	}
+	for _, v := range samples {
+		reaction := models.Reaction{PostID: posts[0].ID, UserID: v.userID, Kind: v.kind}
+		created, err := reaction.SaveReaction(server.DB)
+		assert.Equal(t, err, v.err)
+		assert.Equal(t, created, v.created)
+	}
+
+	post := models.Post{}
+	_, err = post.FindPostByID(server.DB, posts[0].ID)
+	if err != nil {
+		t.Errorf("this is the error getting the post: %v\n", err)
+		return
+	}
+	assert.Equal(t, post.Reactions["like"], 2)
+	assert.Equal(t, post.Reactions["wow"], 1)
+	assert.Equal(t, post.Reactions["sad"], 0)
+	assert.Equal(t, post.ReactedAt != nil, true)
+
+	reaction := models.Reaction{}
+	deleted, err := reaction.DeleteReaction(server.DB, posts[0].ID, users[0].ID, "like")
+	if err != nil {
+		t.Errorf("this is the error deleting the reaction: %v\n", err)
+	}
+	assert.Equal(t, deleted, int64(1))
+}
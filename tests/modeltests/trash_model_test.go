@@ -0,0 +1,130 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/models"
+)
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+
+	// A post deleted on its own stays in the trash when its author returns.
+	_, err = posts[0].DeleteAPost(server.DB, posts[0].ID, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the post: %v\n", err)
+		return
+	}
+	extra := models.Post{Title: "Deleted with the author", Content: "content", AuthorID: users[0].ID}
+	err = server.DB.Create(&extra).Error
+	if err != nil {
+		log.Fatalf("Error seeding post %v\n", err)
+	}
+
+	time.Sleep(time.Second)
+	isDeleted, err := userInstance.DeleteAUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, isDeleted, int64(1))
+
+	_, err = userInstance.FindUserByID(server.DB, users[0].ID)
+	assert.NotEqual(t, err, nil)
+	postsFound, err := postInstance.FindAllPosts(server.DB)
+	if err != nil {
+		t.Errorf("this is the error getting posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*postsFound), 1)
+
+	trashed, err := postInstance.FindDeletedPosts(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error getting trashed posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*trashed), 2)
+	for _, p := range *trashed {
+		assert.Equal(t, p.Author.ID, users[0].ID)
+	}
+
+	post := models.Post{}
+	_, err = post.RestorePost(server.DB, extra.ID)
+	assert.Equal(t, err, models.ErrAuthorInTrash)
+
+	user := models.User{}
+	restored, err := user.RestoreUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error restoring the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, restored.DeletedAt == nil, true)
+
+	postsFound, err = postInstance.FindAllPosts(server.DB)
+	if err != nil {
+		t.Errorf("this is the error getting posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*postsFound), 2)
+	_, err = postInstance.FindPostByID(server.DB, posts[0].ID)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestPurgeDeleted(t *testing.T) {
+
+	err := refreshUserAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	users, posts, err := seedUsersAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post %v\n", err)
+	}
+
+	_, err = posts[1].DeleteAPost(server.DB, posts[1].ID, users[1].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the post: %v\n", err)
+		return
+	}
+	_, err = userInstance.DeleteAUser(server.DB, users[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+		return
+	}
+
+	samples := []struct {
+		before time.Time
+		posts  int64
+		users  int64
+	}{
+		{before: time.Now().AddDate(0, 0, -30), posts: 0, users: 0},
+		{before: time.Now().Add(time.Minute), posts: 2, users: 1},
+	}
+	for _, v := range samples {
+		purgedPosts, purgedUsers, err := models.PurgeDeleted(server.DB, v.before)
+		if err != nil {
+			t.Errorf("this is the error purging: %v\n", err)
+			return
+		}
+		assert.Equal(t, purgedPosts, v.posts)
+		assert.Equal(t, purgedUsers, v.users)
+	}
+
+	var count int
+	server.DB.Unscoped().Model(&models.Post{}).Count(&count)
+	assert.Equal(t, count, 0)
+	server.DB.Unscoped().Model(&models.User{}).Count(&count)
+	assert.Equal(t, count, 1)
+}
@@ -78,6 +78,47 @@ func TestGetUserByID(t *testing.T) {
 	assert.Equal(t, foundUser.Nickname, user.Nickname)
 }
 
+func TestGetUserByEmail(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+
+	// Emails of new users are stored in lower case, those of older ones
+	// may not be, and both are found whatever the case asked for.
+	newUser := models.User{Nickname: "new", Email: " New@Gmail.com ", Password: "password"}
+	newUser.Prepare()
+	assert.Equal(t, newUser.Email, "new@gmail.com")
+	err = server.DB.Create(&newUser).Error
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+	oldUser := models.User{Nickname: "old", Email: "Old@Gmail.com", Password: "password"}
+	err = server.DB.Create(&oldUser).Error
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+
+	samples := []struct {
+		email string
+		id    uint32
+	}{
+		{email: "NEW@gmail.com", id: newUser.ID},
+		{email: "old@gmail.com", id: oldUser.ID},
+		{email: "Old@Gmail.com", id: oldUser.ID},
+	}
+	for _, v := range samples {
+		found := models.User{}
+		_, err = found.FindUserByEmail(server.DB, v.email)
+		if err != nil {
+			t.Errorf("this is the error getting the user by email: %v\n", err)
+			continue
+		}
+		assert.Equal(t, found.ID, v.id)
+	}
+}
+
 func TestUpdateUser(t *testing.T) {
 
 	err := refreshUserTable()
@@ -95,6 +136,7 @@ func TestUpdateUser(t *testing.T) {
 		Email:    "updated@ttt.com",
 		Nickname: "UpdatedUser",
 		Password: "new password",
+		Version:  user.Version,
 	}
 	updatedUser, err := updateUser.UpdateAUser(server.DB, user.ID)
 	if err != nil {
@@ -105,6 +147,35 @@ func TestUpdateUser(t *testing.T) {
 	assert.Equal(t, updatedUser.ID, updateUser.ID)
 	assert.Equal(t, updatedUser.Email, updateUser.Email)
 	assert.Equal(t, updatedUser.Nickname, updateUser.Nickname)
+	// profile updates never touch the password
+	assert.Equal(t, models.VerifyPassword(updatedUser.Password, "password"), nil)
+}
+
+func TestUpdatePassword(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user table %v\n", err)
+	}
+
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+
+	err = user.UpdatePassword(server.DB, "new password")
+	if err != nil {
+		t.Errorf("this is the error updating the password: %v\n", err)
+		return
+	}
+
+	foundUser, err := userInstance.FindUserByID(server.DB, user.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, models.VerifyPassword(foundUser.Password, "new password"), nil)
+	assert.NotEqual(t, models.VerifyPassword(foundUser.Password, "password"), nil)
 }
 
 func TestDeleteUser(t *testing.T) {
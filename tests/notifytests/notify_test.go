@@ -0,0 +1,82 @@
+package notifytests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/notify"
+)
+
+func receive(t *testing.T, events <-chan notify.Event) (notify.Event, bool) {
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(time.Second):
+		t.Errorf("no event received")
+		return notify.Event{}, false
+	}
+}
+
+func TestBrokers(t *testing.T) {
+
+	mr := miniredis.RunT(t)
+	samples := []struct {
+		name   string
+		broker notify.Broker
+	}{
+		{name: "memory", broker: notify.NewMemory()},
+		{name: "redis", broker: notify.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))},
+	}
+
+	for _, v := range samples {
+		ctx, cancel := context.WithCancel(context.Background())
+		mine, err := v.broker.Subscribe(ctx, 1)
+		if err != nil {
+			t.Fatalf("%s: this is the error subscribing: %v", v.name, err)
+		}
+		others, err := v.broker.Subscribe(ctx, 2)
+		if err != nil {
+			t.Fatalf("%s: this is the error subscribing: %v", v.name, err)
+		}
+
+		err = v.broker.Publish(ctx, 1, notify.Event{ID: "7", Name: "notification", Data: []byte(`{"id":7}`)})
+		if err != nil {
+			t.Errorf("%s: this is the error publishing: %v", v.name, err)
+		}
+		event, ok := receive(t, mine)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, event.ID, "7")
+		assert.Equal(t, event.Name, "notification")
+		assert.Equal(t, string(event.Data), `{"id":7}`)
+
+		select {
+		case <-others:
+			t.Errorf("%s: the event of another user was received", v.name)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		cancel()
+		_, ok = receive(t, mine)
+		assert.Equal(t, ok, false)
+	}
+}
+
+func TestEventEncode(t *testing.T) {
+
+	samples := []struct {
+		event notify.Event
+		wire  string
+	}{
+		{event: notify.Event{ID: "3", Name: "notification", Data: []byte(`{"id":3}`)}, wire: "id: 3\nevent: notification\ndata: {\"id\":3}\n\n"},
+		{event: notify.Event{Name: "unread", Data: []byte(`{"unread_count":0}`)}, wire: "event: unread\ndata: {\"unread_count\":0}\n\n"},
+	}
+
+	for _, v := range samples {
+		assert.Equal(t, string(v.event.Encode()), v.wire)
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimittests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/ratelimit"
+)
+
+// clock is a fake time source shared by the stores under test.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestStores(t *testing.T) {
+
+	c := &clock{now: time.Unix(1700000000, 0)}
+	memory := ratelimit.NewMemory()
+	memory.Now = c.Now
+	mr := miniredis.RunT(t)
+	rs := ratelimit.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	rs.Now = c.Now
+
+	samples := []struct {
+		name  string
+		store ratelimit.Store
+	}{
+		{name: "memory", store: memory},
+		{name: "redis", store: rs},
+	}
+
+	// Three requests at once, then one every 20 seconds.
+	policy := ratelimit.Policy{Name: "test", Limit: 3, Period: time.Minute}
+	ctx := context.Background()
+	for _, v := range samples {
+		start := c.now
+
+		for i := 2; i >= 0; i-- {
+			res, err := v.store.Take(ctx, "ip:1.2.3.4", policy)
+			if err != nil {
+				t.Errorf("%s: this is the error taking: %v", v.name, err)
+			}
+			assert.Equal(t, res.Allowed, true)
+			assert.Equal(t, res.Remaining, i)
+			assert.Equal(t, res.Limit, 3)
+		}
+
+		res, err := v.store.Take(ctx, "ip:1.2.3.4", policy)
+		if err != nil {
+			t.Errorf("%s: this is the error taking: %v", v.name, err)
+		}
+		assert.Equal(t, res.Allowed, false)
+		assert.Equal(t, res.RetryAfter, 20*time.Second)
+		assert.Equal(t, res.Reset, time.Minute)
+
+		// Other clients have their own bucket.
+		res, err = v.store.Take(ctx, "ip:5.6.7.8", policy)
+		if err != nil {
+			t.Errorf("%s: this is the error taking: %v", v.name, err)
+		}
+		assert.Equal(t, res.Allowed, true)
+
+		c.now = c.now.Add(20 * time.Second)
+		res, err = v.store.Take(ctx, "ip:1.2.3.4", policy)
+		if err != nil {
+			t.Errorf("%s: this is the error taking: %v", v.name, err)
+		}
+		assert.Equal(t, res.Allowed, true)
+		assert.Equal(t, res.Remaining, 0)
+
+		c.now = start.Add(time.Hour)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+
+	samples := []struct {
+		spec         string
+		policy       *ratelimit.Policy
+		errorMessage string
+	}{
+		{spec: "10/1m", policy: &ratelimit.Policy{Name: "login", Limit: 10, Period: time.Minute}},
+		{spec: "100/1h,burst=20", policy: &ratelimit.Policy{Name: "login", Limit: 100, Period: time.Hour, Burst: 20}},
+		{spec: "off"},
+		{spec: "10", errorMessage: `rate limit login: expected <limit>/<period>, got "10"`},
+		{spec: "0/1m", errorMessage: `rate limit login: invalid limit "0"`},
+		{spec: "10/soon", errorMessage: `rate limit login: invalid period "soon"`},
+		{spec: "10/1m,size=2", errorMessage: `rate limit login: unknown option "size=2"`},
+	}
+
+	for _, v := range samples {
+		policy, err := ratelimit.ParsePolicy("login", v.spec)
+		if v.errorMessage != "" {
+			assert.Equal(t, err.Error(), v.errorMessage)
+			continue
+		}
+		if err != nil {
+			t.Errorf("this is the error parsing %s: %v", v.spec, err)
+		}
+		assert.Equal(t, policy, v.policy)
+	}
+}
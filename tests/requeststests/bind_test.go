@@ -0,0 +1,86 @@
+package requeststests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/requests"
+)
+
+type postInput struct {
+	Title   string   `json:"title"`
+	Version uint32   `json:"version"`
+	Tags    []string `json:"tags"`
+}
+
+func TestBind(t *testing.T) {
+
+	samples := []struct {
+		contentType  string
+		body         string
+		limit        int64
+		statusCode   int
+		errorMessage string
+	}{
+		{contentType: "application/json", body: `{"title": "Title", "version": 2}`},
+		{contentType: "application/json; charset=utf-8", body: `{"title": "Title"}`},
+		{contentType: "", body: `{"title": "Title"}`, statusCode: 415, errorMessage: "Content-Type Must Be application/json"},
+		{contentType: "text/plain", body: `{"title": "Title"}`, statusCode: 415, errorMessage: "Content-Type Must Be application/json"},
+		{contentType: "application/json", body: ``, statusCode: 400, errorMessage: "Request Body Is Empty"},
+		{contentType: "application/json", body: `{"title": "Title",}`, statusCode: 400, errorMessage: "Malformed JSON At Offset 19"},
+		{contentType: "application/json", body: `{"title": "Title"`, statusCode: 400, errorMessage: "Malformed JSON, The Body Ends Unexpectedly"},
+		{contentType: "application/json", body: `["title"]`, statusCode: 400, errorMessage: "Request Body Must Be A JSON Object"},
+		{contentType: "application/json", body: `{"title": "Title"} {}`, statusCode: 400, errorMessage: "Request Body Must Contain A Single JSON Object"},
+		{contentType: "application/json", body: `{"title": 1}`, statusCode: 422, errorMessage: "Field title Must Be A String"},
+		{contentType: "application/json", body: `{"version": -1}`, statusCode: 422, errorMessage: "Field version Must Be An Integer"},
+		{contentType: "application/json", body: `{"tags": "go"}`, statusCode: 422, errorMessage: "Field tags Must Be An Array"},
+		{contentType: "application/json", body: `{"title": "Title", "author_id": 1}`, statusCode: 422, errorMessage: "Unknown Field author_id"},
+		{contentType: "application/json", body: `{"title": "` + strings.Repeat("a", 64) + `"}`, limit: 32, statusCode: 413, errorMessage: "Request Body Too Large, The Limit Is 32 Bytes"},
+	}
+
+	for _, v := range samples {
+		req := httptest.NewRequest("POST", "/posts", strings.NewReader(v.body))
+		if v.contentType != "" {
+			req.Header.Set("Content-Type", v.contentType)
+		}
+		if v.limit != 0 {
+			req = req.WithContext(requests.WithMaxBodySize(req.Context(), v.limit))
+		}
+
+		input := postInput{}
+		err := requests.Bind(httptest.NewRecorder(), req, &input)
+		if v.errorMessage == "" {
+			if err != nil {
+				t.Errorf("this is the error binding %s: %v", v.body, err)
+			}
+			assert.Equal(t, input.Title, "Title")
+			continue
+		}
+
+		bindErr, ok := err.(*requests.Error)
+		if !ok {
+			t.Errorf("expected a bind error for %s, got %v", v.body, err)
+			continue
+		}
+		assert.Equal(t, bindErr.Status, v.statusCode)
+		assert.Equal(t, bindErr.Message, v.errorMessage)
+	}
+}
+
+func TestBindDefaultLimit(t *testing.T) {
+
+	body := `{"title": "` + strings.Repeat("a", int(requests.DefaultMaxBodySize)) + `"}`
+	req := httptest.NewRequest("POST", "/posts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	err := requests.Bind(httptest.NewRecorder(), req, &postInput{})
+	bindErr, ok := err.(*requests.Error)
+	if !ok {
+		t.Fatalf("expected a bind error, got %v", err)
+	}
+	assert.Equal(t, bindErr.Status, http.StatusRequestEntityTooLarge)
+}
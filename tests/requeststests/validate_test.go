@@ -0,0 +1,62 @@
+package requeststests
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/Funskie/blogIris/api/requests"
+)
+
+type signupInput struct {
+	Nickname string `json:"nickname" validate:"required,max=8"`
+	Email    string `json:"email" validate:"required,email"`
+}
+
+type profileInput struct {
+	signupInput
+	CurrentPassword *string  `json:"current_password" validate:"required,min=4"`
+	Tags            []string `json:"tags" validate:"max=2"`
+	Version         uint32   `json:"version" validate:"min=1"`
+}
+
+func TestValidate(t *testing.T) {
+
+	short, empty, long := "abc", " ", "abcd"
+	valid := signupInput{Nickname: "pet", Email: "pet@gmail.com"}
+
+	samples := []struct {
+		input        profileInput
+		errorMessage string
+	}{
+		{input: profileInput{signupInput: valid, Version: 1}},
+		{input: profileInput{signupInput: valid, CurrentPassword: &long, Version: 1}},
+		{input: profileInput{signupInput: signupInput{Email: "pet@gmail.com"}, Version: 1}, errorMessage: "Required Nickname"},
+		{input: profileInput{signupInput: signupInput{Nickname: "  ", Email: "pet@gmail.com"}, Version: 1}, errorMessage: "Required Nickname"},
+		{input: profileInput{signupInput: signupInput{Nickname: strings.Repeat("é", 9), Email: "pet@gmail.com"}, Version: 1}, errorMessage: "Nickname Must Be At Most 8 Characters"},
+		{input: profileInput{signupInput: signupInput{Nickname: "pet", Email: "petgmail.com"}, Version: 1}, errorMessage: "Invalid Email"},
+		{input: profileInput{signupInput: valid, CurrentPassword: &empty, Version: 1}, errorMessage: "Required Current Password"},
+		{input: profileInput{signupInput: valid, CurrentPassword: &short, Version: 1}, errorMessage: "Current Password Must Be At Least 4 Characters"},
+		{input: profileInput{signupInput: valid, Tags: []string{"a", "b", "c"}, Version: 1}, errorMessage: "Tags Must Be At Most 2 Items"},
+		{input: profileInput{signupInput: valid}, errorMessage: "Version Must Be At Least 1"},
+	}
+
+	for _, v := range samples {
+		err := requests.Validate(&v.input)
+		if v.errorMessage == "" {
+			if err != nil {
+				t.Errorf("this is the error validating %+v: %v", v.input, err)
+			}
+			continue
+		}
+
+		validateErr, ok := err.(*requests.Error)
+		if !ok {
+			t.Errorf("expected a validation error for %+v, got %v", v.input, err)
+			continue
+		}
+		assert.Equal(t, validateErr.Status, 422)
+		assert.Equal(t, validateErr.Message, v.errorMessage)
+	}
+}